@@ -30,8 +30,13 @@ type Broker struct {
 	connErr       error
 	lock          sync.Mutex
 	opened        int32
+	requestCount  int64 // requests written over the broker's lifetime, across reconnects
 	responses     chan *responsePromise
 	done          chan bool
+	apiVersions   map[int16]ApiVersionsResponseKey // supported versions by API key, if the broker reported them
+
+	throttleLock  sync.Mutex
+	throttleUntil time.Time // the broker asked us not to send before this time
 
 	metricRegistry         metrics.Registry
 	incomingByteRate       metrics.Meter
@@ -125,6 +130,7 @@ type responsePromise struct {
 	requestTime   time.Time
 	correlationID int32
 	headerVersion int16
+	maxWaitTime   time.Duration // how long the broker may hold the request before answering
 	handler       func([]byte, error)
 	packets       chan []byte
 	errors        chan error
@@ -181,31 +187,39 @@ func (b *Broker) Open(conf *Config) error {
 
 			// Send an ApiVersionsRequest to identify the client (KIP-511).
 			// Ideally Sarama would use the response to control protocol versions,
-			// but for now just fire-and-forget just to send
+			// but for now the supported versions are only recorded
 			if usingApiVersionsRequests {
-				_, err = b.ApiVersions(&ApiVersionsRequest{
+				var res *ApiVersionsResponse
+				res, err = b.ApiVersions(&ApiVersionsRequest{
 					Version:               3,
 					ClientSoftwareName:    defaultClientSoftwareName,
 					ClientSoftwareVersion: version(),
 				})
 				if err != nil {
 					Logger.Printf("Error while sending ApiVersionsRequest to broker %s: %s\n", b.addr, err)
+				} else {
+					b.setApiVersions(res)
 				}
 			}
 		}()
 		dialer := conf.getDialer()
+		dialStart := time.Now()
 		b.conn, b.connErr = dialer.Dial("tcp", b.addr)
+		if b.connErr == nil && conf.Net.TLS.Enable {
+			b.conn, b.connErr = handshakeTLS(b.conn, b.addr, conf)
+		}
+		dialTime := time.Since(dialStart)
+		getOrRegisterHistogram("connect-latency-in-ms", b.metricRegistry).Update(int64(dialTime / time.Millisecond))
+		if conf.Net.SlowDialThreshold > 0 && dialTime > conf.Net.SlowDialThreshold {
+			Logger.Printf("Connecting to broker %s took %v, more than Net.SlowDialThreshold\n", b.addr, dialTime)
+		}
 		if b.connErr != nil {
 			Logger.Printf("Failed to connect to broker %s: %s\n", b.addr, b.connErr)
 			b.conn = nil
 			atomic.StoreInt32(&b.opened, 0)
 			return
 		}
-		if conf.Net.TLS.Enable {
-			b.conn = tls.Client(b.conn, validServerNameTLS(b.addr, conf.Net.TLS.Config))
-		}
-
-		b.conn = newBufConn(b.conn)
+		b.conn = newBufConn(b.conn, conf.Net.ReadBufferSize)
 		b.conf = conf
 
 		// Create or reuse the global metrics shared between brokers
@@ -319,6 +333,7 @@ func (b *Broker) Close() error {
 	b.connErr = nil
 	b.done = nil
 	b.responses = nil
+	b.apiVersions = nil
 
 	b.metricRegistry.UnregisterAll()
 
@@ -333,6 +348,35 @@ func (b *Broker) Close() error {
 	return err
 }
 
+func (b *Broker) setApiVersions(res *ApiVersionsResponse) {
+	if KError(res.ErrorCode) != ErrNoError {
+		return
+	}
+
+	apiVersions := make(map[int16]ApiVersionsResponseKey, len(res.ApiKeys))
+	for _, key := range res.ApiKeys {
+		apiVersions[key.ApiKey] = key
+	}
+
+	b.lock.Lock()
+	b.apiVersions = apiVersions
+	b.lock.Unlock()
+}
+
+// supportsVersion reports whether the broker advertised support for the given
+// version of an API. If its supported versions are unknown, for example
+// because it predates ApiVersionsRequest, only version 0 is assumed.
+func (b *Broker) supportsVersion(apiKey, version int16) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.apiVersions == nil {
+		return version == 0
+	}
+	key, ok := b.apiVersions[apiKey]
+	return ok && version >= key.MinVersion && version <= key.MaxVersion
+}
+
 // ID returns the broker ID retrieved from Kafka's metadata, or -1 if that is not known.
 func (b *Broker) ID() int32 {
 	return b.id
@@ -444,6 +488,9 @@ func (b *Broker) AsyncProduce(request *ProduceRequest, cb ProduceCallback) error
 
 				// Wellformed response
 				b.updateThrottleMetric(res.ThrottleTime)
+				if request.Version >= 6 {
+					b.setThrottle(res.ThrottleTime)
+				}
 				cb(res, nil)
 			},
 		}
@@ -465,6 +512,9 @@ func (b *Broker) Produce(request *ProduceRequest) (*ProduceResponse, error) {
 		response = new(ProduceResponse)
 		err = b.sendAndReceive(request, response)
 		b.updateThrottleMetric(response.ThrottleTime)
+		if request.Version >= 6 {
+			b.setThrottle(response.ThrottleTime)
+		}
 	}
 
 	if err != nil {
@@ -492,6 +542,10 @@ func (b *Broker) Fetch(request *FetchRequest) (*FetchResponse, error) {
 		return nil, err
 	}
 
+	if request.Version >= 8 {
+		b.setThrottle(response.ThrottleTime)
+	}
+
 	return response, nil
 }
 
@@ -592,6 +646,21 @@ func (b *Broker) DescribeGroups(request *DescribeGroupsRequest) (*DescribeGroups
 	return response, nil
 }
 
+// ping sends the cheapest request the broker understands, to check that it
+// is still answering.
+func (b *Broker) ping() error {
+	b.lock.Lock()
+	conf := b.conf
+	b.lock.Unlock()
+
+	if conf != nil && conf.Version.IsAtLeast(V0_10_0_0) {
+		_, err := b.ApiVersions(&ApiVersionsRequest{})
+		return err
+	}
+	_, err := b.GetMetadata(&MetadataRequest{})
+	return err
+}
+
 // ApiVersions return api version response or error
 func (b *Broker) ApiVersions(request *ApiVersionsRequest) (*ApiVersionsResponse, error) {
 	response := new(ApiVersionsResponse)
@@ -908,10 +977,36 @@ func (b *Broker) AlterClientQuotas(request *AlterClientQuotasRequest) (*AlterCli
 	return response, nil
 }
 
+// handshakeTLS wraps conn in a TLS client and performs the handshake right
+// away, within Net.DialTimeout, rather than lazily on the first request, so
+// that it is part of the measured connection time. conn is closed if the
+// handshake fails.
+func handshakeTLS(conn net.Conn, addr string, conf *Config) (net.Conn, error) {
+	tlsConn := tls.Client(conn, validServerNameTLS(addr, conf.Net.TLS.Config))
+	if err := tlsConn.SetDeadline(time.Now().Add(conf.Net.DialTimeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
 // readFull ensures the conn ReadDeadline has been setup before making a
 // call to io.ReadFull
 func (b *Broker) readFull(buf []byte) (n int, err error) {
-	if err := b.conn.SetReadDeadline(time.Now().Add(b.conf.Net.ReadTimeout)); err != nil {
+	return b.readFullWithin(buf, b.conf.Net.ReadTimeout)
+}
+
+// readFullWithin is readFull with a read deadline of timeout
+func (b *Broker) readFullWithin(buf []byte, timeout time.Duration) (n int, err error) {
+	if err := b.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
 		return 0, err
 	}
 
@@ -953,6 +1048,8 @@ func makeResponsePromise(responseHeaderVersion int16) *responsePromise {
 }
 
 func (b *Broker) sendWithPromise(rb protocolBody, promise *responsePromise) error {
+	b.waitIfThrottled()
+
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
@@ -980,7 +1077,7 @@ func (b *Broker) sendInternal(rb protocolBody, promise *responsePromise) error {
 	}
 
 	req := &request{correlationID: b.correlationID, clientID: b.conf.ClientID, body: rb}
-	buf, err := encode(req, b.metricRegistry)
+	buf, err := encodePooled(req, b.metricRegistry)
 	if err != nil {
 		return err
 	}
@@ -989,12 +1086,15 @@ func (b *Broker) sendInternal(rb protocolBody, promise *responsePromise) error {
 	// Will be decremented in responseReceiver (except error or request with NoResponse)
 	b.addRequestInFlightMetrics(1)
 	bytes, err := b.write(buf)
+	// the connection holds no reference to buf once the write has returned
+	releaseEncodeBuffer(buf)
 	b.updateOutgoingCommunicationMetrics(bytes)
 	if err != nil {
 		b.addRequestInFlightMetrics(-1)
 		return err
 	}
 	b.correlationID++
+	atomic.AddInt64(&b.requestCount, 1)
 
 	if promise == nil {
 		// Record request latency without the response
@@ -1003,6 +1103,10 @@ func (b *Broker) sendInternal(rb protocolBody, promise *responsePromise) error {
 	}
 
 	promise.requestTime = requestTime
+	if fetch, ok := rb.(*FetchRequest); ok {
+		// the broker may hold a fetch for up to MaxWaitTime before answering
+		promise.maxWaitTime = time.Duration(fetch.MaxWaitTime) * time.Millisecond
+	}
 	promise.correlationID = req.correlationID
 	b.responses <- promise
 
@@ -1112,7 +1216,7 @@ func (b *Broker) responseReceiver() {
 		headerLength := getHeaderLength(response.headerVersion)
 		header := make([]byte, headerLength)
 
-		bytesReadHeader, err := b.readFull(header)
+		bytesReadHeader, err := b.readFullWithin(header, b.conf.Net.ReadTimeout+response.maxWaitTime)
 		requestLatency := time.Since(response.requestTime)
 		if err != nil {
 			b.updateIncomingCommunicationMetrics(bytesReadHeader, requestLatency)
@@ -1610,6 +1714,36 @@ func (b *Broker) updateThrottleMetric(throttleTime time.Duration) {
 	}
 }
 
+// setThrottle holds back further requests to the broker for throttleTime.
+// Since KIP-219 (Produce v6, Fetch v8) a broker enforcing a quota replies
+// straight away and expects the client to back off, instead of delaying the
+// response itself.
+func (b *Broker) setThrottle(throttleTime time.Duration) {
+	if throttleTime <= 0 {
+		return
+	}
+
+	until := time.Now().Add(throttleTime)
+	b.throttleLock.Lock()
+	if until.After(b.throttleUntil) {
+		b.throttleUntil = until
+	}
+	b.throttleLock.Unlock()
+}
+
+// waitIfThrottled blocks until the throttle time set by setThrottle, if any,
+// has elapsed.
+func (b *Broker) waitIfThrottled() {
+	b.throttleLock.Lock()
+	remaining := time.Until(b.throttleUntil)
+	b.throttleLock.Unlock()
+
+	if remaining > 0 {
+		DebugLogger.Printf("broker/%d waiting %v for throttling to end\n", b.ID(), remaining)
+		time.Sleep(remaining)
+	}
+}
+
 func (b *Broker) registerMetrics() {
 	b.brokerIncomingByteRate = b.registerMeter("incoming-byte-rate")
 	b.brokerRequestRate = b.registerMeter("request-rate")
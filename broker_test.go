@@ -78,6 +78,25 @@ func TestBrokerAccessors(t *testing.T) {
 	}
 }
 
+func TestBrokerDecodeIPv6Address(t *testing.T) {
+	buf := []byte{
+		0x00, 0x00, 0x00, 0x07, // id
+		0x00, 0x03, ':', ':', '1', // host
+		0x00, 0x00, 0x23, 0x84, // port 9092
+	}
+
+	broker := new(Broker)
+	if err := broker.decode(&realDecoder{raw: buf}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if broker.ID() != 7 {
+		t.Errorf("Expected broker ID 7, got %d", broker.ID())
+	}
+	if broker.Addr() != "[::1]:9092" {
+		t.Errorf("Expected a bracketed IPv6 address, got %s", broker.Addr())
+	}
+}
+
 type produceResponsePromise struct {
 	c chan produceResOrError
 }
@@ -196,6 +215,96 @@ func TestBrokerFailedRequest(t *testing.T) {
 	}
 }
 
+func TestBrokerRecordsApiVersions(t *testing.T) {
+	mockBroker := NewMockBroker(t, 0)
+	defer mockBroker.Close()
+
+	mockBroker.SetHandlerByMap(map[string]MockResponse{
+		"ApiVersionsRequest": NewMockApiVersionsResponse(t).SetApiKeys([]ApiVersionsResponseKey{
+			{ApiKey: 3, MinVersion: 0, MaxVersion: 9},
+		}),
+	})
+
+	broker := NewBroker(mockBroker.Addr())
+	conf := NewTestConfig()
+	conf.Version = V2_4_0_0
+
+	if broker.supportsVersion(3, 1) {
+		t.Error("Expected an unopened broker to only support version 0")
+	}
+	if !broker.supportsVersion(3, 0) {
+		t.Error("Expected an unopened broker to support version 0")
+	}
+
+	if err := broker.Open(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, broker)
+
+	deadline := time.Now().Add(time.Second)
+	for !broker.supportsVersion(3, 9) {
+		if time.Now().After(deadline) {
+			t.Fatal("Broker did not record the versions from its ApiVersionsResponse")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if broker.supportsVersion(3, 10) {
+		t.Error("Expected version 10 of Metadata to be unsupported")
+	}
+	if broker.supportsVersion(0, 0) {
+		t.Error("Expected an API missing from the ApiVersionsResponse to be unsupported")
+	}
+}
+
+func TestBrokerWaitsForThrottleTime(t *testing.T) {
+	mb := NewMockBroker(t, 0)
+	defer mb.Close()
+	mb.Returns(&ProduceResponse{Version: 7, ThrottleTime: 200 * time.Millisecond})
+	mb.Returns(&ProduceResponse{Version: 7})
+
+	broker := NewBroker(mb.Addr())
+	conf := NewTestConfig()
+	conf.ApiVersionsRequest = false
+	conf.Version = V2_1_0_0
+	if err := broker.Open(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, broker)
+
+	if _, err := broker.Produce(&ProduceRequest{Version: 7, RequiredAcks: WaitForLocal}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := broker.Produce(&ProduceRequest{Version: 7, RequiredAcks: WaitForLocal}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected the next request to wait for the throttle time, it was sent after %v", elapsed)
+	}
+}
+
+func TestBrokerFetchReadDeadlineIncludesMaxWaitTime(t *testing.T) {
+	mb := NewMockBroker(t, 0)
+	defer mb.Close()
+	mb.SetLatency(150 * time.Millisecond)
+	mb.Returns(new(FetchResponse))
+
+	broker := NewBroker(mb.Addr())
+	conf := NewTestConfig()
+	conf.ApiVersionsRequest = false
+	conf.Net.ReadTimeout = 100 * time.Millisecond
+	if err := broker.Open(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, broker)
+
+	// the broker holds the fetch for longer than Net.ReadTimeout but less
+	// than Net.ReadTimeout + MaxWaitTime
+	if _, err := broker.Fetch(&FetchRequest{MaxWaitTime: 200}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 var ErrTokenFailure = errors.New("Failure generating token")
 
 type TokenProvider struct {
@@ -1399,6 +1508,9 @@ func validateBrokerMetrics(t *testing.T, broker *Broker, mockBrokerMetrics broke
 	// Check that there is no more requests in flight
 	metricValidators.registerForAllBrokers(broker, counterValidator("requests-in-flight", 0))
 
+	// Check that the single dial to the mock broker was timed
+	metricValidators.register(countHistogramValidator("connect-latency-in-ms", 1))
+
 	// Run the validators
 	metricValidators.run(t, broker.conf.MetricRegistry)
 }
@@ -2,8 +2,11 @@ package sarama
 
 import (
 	"errors"
+	"fmt"
 	"math/rand"
+	"net"
 	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -34,9 +37,22 @@ type Client interface {
 	// Broker returns the active Broker if available for the broker ID.
 	Broker(brokerID int32) (*Broker, error)
 
-	// Topics returns the set of available topics as retrieved from cluster metadata.
+	// BrokerStats returns, for each active broker ID, the number of requests
+	// sent to that broker since its Broker object was created.
+	BrokerStats() map[int32]int64
+
+	// Topics refreshes the metadata for all topics with a single metadata
+	// request and returns the sorted set of available topics. Topics the
+	// cluster returned an error for are omitted, while an error reaching the
+	// cluster is returned. As with any refresh of all topics, the client tracks
+	// every topic of the cluster afterwards, even if Metadata.Full is
+	// disabled.
 	Topics() ([]string, error)
 
+	// HasTopic reports whether metadata for the given topic is currently cached.
+	// Unlike most other methods it never queries the cluster.
+	HasTopic(topic string) bool
+
 	// Partitions returns the sorted list of all partition IDs for the given topic.
 	Partitions(topic string) ([]int32, error)
 
@@ -49,6 +65,13 @@ type Client interface {
 	// topic/partition, as determined by querying the cluster metadata.
 	Leader(topic string, partitionID int32) (*Broker, error)
 
+	// WaitForLeader blocks until the given topic/partition has an available
+	// leader. Each attempt sends a single metadata request, and attempts are
+	// spaced out with the backoff configured in Metadata.Retry, but at least
+	// 50ms. If no leader appears within timeout it returns the last error,
+	// typically ErrLeaderNotAvailable.
+	WaitForLeader(topic string, partitionID int32, timeout time.Duration) error
+
 	// Replicas returns the set of all replica IDs for the given partition.
 	Replicas(topic string, partitionID int32) ([]int32, error)
 
@@ -61,6 +84,14 @@ type Client interface {
 	// partition. Offline replicas are replicas which are offline
 	OfflineReplicas(topic string, partitionID int32) ([]int32, error)
 
+	// OfflinePartitions refreshes the metadata for all topics with a single
+	// metadata request and returns, per topic, the sorted IDs of the partitions
+	// that currently have no leader. Topics whose partitions all have a leader,
+	// and topics the cluster returned an error for, are omitted. As with any
+	// refresh of all topics, the client tracks every topic of the cluster
+	// afterwards, even if Metadata.Full is disabled.
+	OfflinePartitions() (map[string][]int32, error)
+
 	// RefreshBrokers takes a list of addresses to be used as seed brokers.
 	// Existing broker connections are closed and the updated list of seed brokers
 	// will be used for the next metadata fetch.
@@ -90,6 +121,11 @@ type Client interface {
 	// InitProducerID retrieves information required for Idempotent Producer
 	InitProducerID() (*InitProducerIDResponse, error)
 
+	// HealthCheck sends a minimal request to the broker the client would use for
+	// its next cluster-wide request and returns an error if it does not answer
+	// within Net.ReadTimeout.
+	HealthCheck() error
+
 	// Close shuts down all broker connections managed by this client. It is required
 	// to call this function before a client object passes out of scope, as it will
 	// otherwise leak memory. You must close any Producers or Consumers using a client
@@ -135,7 +171,22 @@ type client struct {
 
 	lock sync.RWMutex // protects access to the maps that hold cluster state.
 
+	refreshLock sync.Mutex                  // protects access to refreshes
+	refreshes   map[string]*metadataRefresh // in-flight and recently failed single-topic metadata refreshes, by topic
+
 	updateMetaDataMs int64 // store update metadata time
+
+	// start time of the last successful refresh covering all the topics the
+	// background updater refreshes
+	backgroundRefreshMs int64
+}
+
+// metadataRefresh is a metadata refresh shared by every caller that asked
+// for the same topic while it was in flight.
+type metadataRefresh struct {
+	done    chan none
+	err     error
+	expires time.Time // set once a failed refresh is kept for Metadata.TopicRefreshBackoff
 }
 
 // NewClient creates a new Client. It connects to one of the given broker addresses
@@ -165,6 +216,14 @@ func NewClient(addrs []string, conf *Config) (Client, error) {
 		metadataTopics:          make(map[string]none),
 		cachedPartitionsResults: make(map[string][maxPartitionIndex][]int32),
 		coordinators:            make(map[string]int32),
+		refreshes:               make(map[string]*metadataRefresh),
+	}
+
+	if conf.Net.ResolveSeedSRV {
+		var err error
+		if addrs, err = client.resolveSeedSRV(addrs); err != nil {
+			return nil, err
+		}
 	}
 
 	client.randomizeSeedBrokers(addrs)
@@ -214,6 +273,16 @@ func (client *client) Broker(brokerID int32) (*Broker, error) {
 	return broker, nil
 }
 
+func (client *client) BrokerStats() map[int32]int64 {
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+	stats := make(map[int32]int64, len(client.brokers))
+	for id, broker := range client.brokers {
+		stats[id] = atomic.LoadInt64(&broker.requestCount)
+	}
+	return stats
+}
+
 func (client *client) InitProducerID() (*InitProducerIDResponse, error) {
 	brokerErrors := make([]error, 0)
 	for broker := client.anyBroker(); broker != nil; broker = client.anyBroker() {
@@ -235,6 +304,23 @@ func (client *client) InitProducerID() (*InitProducerIDResponse, error) {
 	return nil, Wrap(ErrOutOfBrokers, brokerErrors...)
 }
 
+func (client *client) HealthCheck() error {
+	if client.Closed() {
+		return ErrClosedClient
+	}
+
+	broker := client.anyBroker()
+	if broker == nil {
+		return ErrOutOfBrokers
+	}
+
+	if err := broker.ping(); err != nil {
+		Logger.Printf("client/health broker %s failed its health check: %v\n", broker.Addr(), err)
+		return err
+	}
+	return nil
+}
+
 func (client *client) Close() error {
 	if client.Closed() {
 		// Chances are this is being called from a defer() and the error will go unobserved
@@ -278,6 +364,10 @@ func (client *client) Topics() ([]string, error) {
 		return nil, ErrClosedClient
 	}
 
+	if err := client.refreshAllTopicsOnce(); err != nil {
+		return nil, err
+	}
+
 	client.lock.RLock()
 	defer client.lock.RUnlock()
 
@@ -285,10 +375,19 @@ func (client *client) Topics() ([]string, error) {
 	for topic := range client.metadata {
 		ret = append(ret, topic)
 	}
+	sort.Strings(ret)
 
 	return ret, nil
 }
 
+func (client *client) HasTopic(topic string) bool {
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	_, ok := client.metadata[topic]
+	return ok
+}
+
 func (client *client) MetadataTopics() ([]string, error) {
 	if client.Closed() {
 		return nil, ErrClosedClient
@@ -431,6 +530,32 @@ func (client *client) OfflineReplicas(topic string, partitionID int32) ([]int32,
 	return dupInt32Slice(metadata.OfflineReplicas), nil
 }
 
+func (client *client) OfflinePartitions() (map[string][]int32, error) {
+	if client.Closed() {
+		return nil, ErrClosedClient
+	}
+
+	if err := client.refreshAllTopicsOnce(); err != nil {
+		return nil, err
+	}
+
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+
+	offline := make(map[string][]int32)
+	for topic, partitions := range client.metadata {
+		for _, partition := range partitions {
+			if partition.Leader == -1 {
+				offline[topic] = append(offline[topic], partition.ID)
+			}
+		}
+		if ids, ok := offline[topic]; ok {
+			sort.Sort(int32Slice(ids))
+		}
+	}
+	return offline, nil
+}
+
 func (client *client) Leader(topic string, partitionID int32) (*Broker, error) {
 	if client.Closed() {
 		return nil, ErrClosedClient
@@ -449,11 +574,66 @@ func (client *client) Leader(topic string, partitionID int32) (*Broker, error) {
 	return leader, err
 }
 
+// minWaitForLeaderBackoff keeps WaitForLeader from refreshing the metadata
+// back to back when Metadata.Retry has no backoff.
+const minWaitForLeaderBackoff = 50 * time.Millisecond
+
+func (client *client) WaitForLeader(topic string, partitionID int32, timeout time.Duration) error {
+	if topic == "" {
+		return ErrInvalidTopic
+	}
+
+	deadline := time.Now().Add(timeout)
+	for attempt := 0; ; attempt++ {
+		if client.Closed() {
+			return ErrClosedClient
+		}
+
+		// each attempt is a single metadata request, so that a leaderless
+		// partition does not run the whole Metadata.Retry chain past timeout
+		leader, err := client.cachedLeader(topic, partitionID)
+		if leader == nil {
+			if _, err = client.refreshMetadataOnce([]string{topic}, deadline); err == nil {
+				_, err = client.cachedLeader(topic, partitionID)
+			}
+		}
+		if err == nil || errors.Is(err, ErrClosedClient) {
+			return err
+		}
+
+		attemptsRemaining := client.conf.Metadata.Retry.Max - attempt
+		if attemptsRemaining < 0 {
+			attemptsRemaining = 0
+		}
+		backoff := client.computeBackoff(attemptsRemaining)
+		if backoff < minWaitForLeaderBackoff {
+			backoff = minWaitForLeaderBackoff
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			// the next attempt would start past the timeout
+			return err
+		}
+		Logger.Printf("client/metadata no leader for %s/%d yet (%v), retrying in %v\n", topic, partitionID, err, backoff)
+		select {
+		case <-client.closer:
+			return ErrClosedClient
+		case <-time.After(backoff):
+		}
+	}
+}
+
 func (client *client) RefreshBrokers(addrs []string) error {
 	if client.Closed() {
 		return ErrClosedClient
 	}
 
+	if client.conf.Net.ResolveSeedSRV {
+		var err error
+		if addrs, err = client.resolveSeedSRV(addrs); err != nil {
+			return err
+		}
+	}
+
 	client.lock.Lock()
 	defer client.lock.Unlock()
 
@@ -496,7 +676,127 @@ func (client *client) RefreshMetadata(topics ...string) error {
 	if client.conf.Metadata.Timeout > 0 {
 		deadline = time.Now().Add(client.conf.Metadata.Timeout)
 	}
-	return client.tryRefreshMetadata(topics, client.conf.Metadata.Retry.Max, deadline)
+	start := time.Now()
+	result := new(refreshResult)
+	var err error
+	if len(topics) == 1 {
+		err = client.refreshTopicShared(topics[0], deadline, result)
+	} else {
+		err = client.tryRefreshMetadata(topics, client.conf.Metadata.Retry.Max, deadline, result)
+	}
+	if err == nil && client.coversBackgroundRefresh(topics) {
+		atomic.StoreInt64(&client.backgroundRefreshMs, start.UnixNano()/int64(time.Millisecond))
+	}
+	client.notifyPartitionCountChanges(result.countChanges)
+	return err
+}
+
+// refreshMetadataOnce refreshes the metadata of topics, or of all topics if
+// there are none, with a single request that is not retried and not shared
+// with concurrent refreshes. It gives up at deadline, or earlier if
+// Metadata.Timeout says so.
+func (client *client) refreshMetadataOnce(topics []string, deadline time.Time) (*refreshResult, error) {
+	start := time.Now()
+	if client.conf.Metadata.Timeout > 0 {
+		if timeout := start.Add(client.conf.Metadata.Timeout); deadline.IsZero() || timeout.Before(deadline) {
+			deadline = timeout
+		}
+	}
+
+	result := new(refreshResult)
+	err := client.tryRefreshMetadata(topics, 0, deadline, result)
+	if err == nil && client.coversBackgroundRefresh(topics) {
+		atomic.StoreInt64(&client.backgroundRefreshMs, start.UnixNano()/int64(time.Millisecond))
+	}
+	client.notifyPartitionCountChanges(result.countChanges)
+	return result, err
+}
+
+// refreshAllTopicsOnce refreshes the metadata of all topics with a single
+// request. Topics the response reports an error for are left out of the
+// cached metadata rather than failing the refresh, so only an error reaching
+// the cluster is returned.
+func (client *client) refreshAllTopicsOnce() error {
+	result, err := client.refreshMetadataOnce(nil, time.Time{})
+	if err != nil && result.topicError {
+		Logger.Println("client/metadata skipping topics with errors:", err)
+		return nil
+	}
+	return err
+}
+
+// coversBackgroundRefresh reports whether refreshing topics refreshes every
+// topic the background updater would.
+func (client *client) coversBackgroundRefresh(topics []string) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	if client.conf.Metadata.Full {
+		return false
+	}
+
+	refreshed := make(map[string]none, len(topics))
+	for _, topic := range topics {
+		refreshed[topic] = none{}
+	}
+
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+	for topic := range client.metadataTopics {
+		if _, ok := refreshed[topic]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// notifyPartitionCountChanges reports the partition count changes found by a
+// refresh to Metadata.OnPartitionCountChanged. It must be called once that
+// refresh has fully completed, so that the callback can refresh the metadata
+// again.
+func (client *client) notifyPartitionCountChanges(changes []partitionCountChange) {
+	for _, change := range changes {
+		client.conf.Metadata.OnPartitionCountChanged(change.topic, change.oldCount, change.newCount)
+	}
+}
+
+// refreshTopicShared refreshes the metadata of a single topic, letting
+// concurrent callers for the same topic wait on one in-flight request
+// rather than each sending their own. A failed refresh is also shared with
+// later callers until Metadata.TopicRefreshBackoff has elapsed. Only the
+// caller that sent the request gets its result filled in.
+func (client *client) refreshTopicShared(topic string, deadline time.Time, result *refreshResult) error {
+	client.refreshLock.Lock()
+	if refresh, ok := client.refreshes[topic]; ok {
+		if refresh.expires.IsZero() || time.Now().Before(refresh.expires) {
+			client.refreshLock.Unlock()
+			<-refresh.done
+			return refresh.err
+		}
+	}
+	refresh := &metadataRefresh{done: make(chan none)}
+	client.refreshes[topic] = refresh
+	client.refreshLock.Unlock()
+
+	refresh.err = client.tryRefreshMetadata([]string{topic}, client.conf.Metadata.Retry.Max, deadline, result)
+
+	client.refreshLock.Lock()
+	if isTopicRefreshError(refresh.err) && client.conf.Metadata.TopicRefreshBackoff > 0 {
+		refresh.expires = time.Now().Add(client.conf.Metadata.TopicRefreshBackoff)
+	} else {
+		delete(client.refreshes, topic)
+	}
+	client.refreshLock.Unlock()
+	close(refresh.done)
+
+	return refresh.err
+}
+
+// isTopicRefreshError reports whether err says the topic itself cannot be
+// used, as opposed to a transient failure such as running out of brokers.
+func isTopicRefreshError(err error) bool {
+	return errors.Is(err, ErrUnknownTopicOrPartition) || errors.Is(err, ErrInvalidTopic) ||
+		errors.Is(err, ErrTopicAuthorizationFailed)
 }
 
 func (client *client) GetOffset(topic string, partitionID int32, time int64) (int64, error) {
@@ -613,6 +913,39 @@ func (client *client) RefreshCoordinator(consumerGroup string) error {
 
 // private broker management helpers
 
+// lookupSRV is replaced in tests
+var lookupSRV = net.LookupSRV
+
+// resolveSeedSRV replaces every SRV record name in names by the addresses of
+// its targets, retrying failed lookups as configured by Metadata.Retry.
+func (client *client) resolveSeedSRV(names []string) ([]string, error) {
+	var addrs []string
+	for _, name := range names {
+		attemptsRemaining := client.conf.Metadata.Retry.Max
+		for {
+			_, records, err := lookupSRV("", "", name)
+			if err == nil && len(records) == 0 {
+				err = errors.New("no records found")
+			}
+			if err == nil {
+				for _, record := range records {
+					addrs = append(addrs, net.JoinHostPort(record.Target, strconv.Itoa(int(record.Port))))
+				}
+				break
+			}
+			if attemptsRemaining <= 0 {
+				return nil, fmt.Errorf("kafka: failed to resolve seed SRV record %s: %w", name, err)
+			}
+			backoff := client.computeBackoff(attemptsRemaining)
+			Logger.Printf("client/seeds failed to resolve SRV record %s (%v), retrying after %dms... (%d attempts remaining)\n", name, err, backoff/time.Millisecond, attemptsRemaining)
+			time.Sleep(backoff)
+			attemptsRemaining--
+		}
+	}
+	DebugLogger.Printf("client/seeds resolved SRV records to %v\n", addrs)
+	return addrs, nil
+}
+
 func (client *client) randomizeSeedBrokers(addrs []string) {
 	random := rand.New(rand.NewSource(time.Now().UnixNano()))
 	for _, index := range random.Perm(len(addrs)) {
@@ -700,13 +1033,28 @@ func (client *client) anyBroker() *Broker {
 		return client.seedBrokers[0]
 	}
 
-	// not guaranteed to be random *or* deterministic
+	// prefer a broker whose connection is open, then the lowest broker ID, so
+	// that the choice is deterministic
+	var chosen *Broker
 	for _, broker := range client.brokers {
-		_ = broker.Open(client.conf)
-		return broker
+		if chosen == nil {
+			chosen = broker
+			continue
+		}
+		brokerOpen, chosenOpen := atomic.LoadInt32(&broker.opened) == 1, atomic.LoadInt32(&chosen.opened) == 1
+		if brokerOpen != chosenOpen {
+			if brokerOpen {
+				chosen = broker
+			}
+		} else if broker.ID() < chosen.ID() {
+			chosen = broker
+		}
+	}
+	if chosen != nil {
+		_ = chosen.Open(client.conf)
 	}
 
-	return nil
+	return chosen
 }
 
 // private caching/lazy metadata helpers
@@ -830,21 +1178,40 @@ func (client *client) backgroundMetadataUpdater() {
 		return
 	}
 
-	ticker := time.NewTicker(client.conf.Metadata.RefreshFrequency)
-	defer ticker.Stop()
+	timer := time.NewTimer(client.conf.Metadata.RefreshFrequency)
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
+			// a successful refresh of the same topics triggered elsewhere since
+			// the last tick pushes the next background refresh back accordingly
+			if wait := client.untilNextBackgroundRefresh(); wait > 0 {
+				timer.Reset(wait)
+				continue
+			}
 			if err := client.refreshMetadata(); err != nil {
 				Logger.Println("Client background metadata update:", err)
 			}
+			timer.Reset(client.conf.Metadata.RefreshFrequency)
 		case <-client.closer:
 			return
 		}
 	}
 }
 
+// untilNextBackgroundRefresh returns how long the background updater should
+// still wait, given the time of the last successful refresh of the topics it
+// refreshes. Refreshes of fewer topics, and failed ones, do not count.
+func (client *client) untilNextBackgroundRefresh() time.Duration {
+	lastMs := atomic.LoadInt64(&client.backgroundRefreshMs)
+	if lastMs == 0 {
+		return 0
+	}
+	last := time.Unix(0, lastMs*int64(time.Millisecond))
+	return time.Until(last.Add(client.conf.Metadata.RefreshFrequency))
+}
+
 func (client *client) refreshMetadata() error {
 	var topics []string
 
@@ -865,7 +1232,8 @@ func (client *client) refreshMetadata() error {
 	return nil
 }
 
-func (client *client) tryRefreshMetadata(topics []string, attemptsRemaining int, deadline time.Time) error {
+func (client *client) tryRefreshMetadata(topics []string, attemptsRemaining int, deadline time.Time, result *refreshResult) error {
+	result.topicError = false
 	pastDeadline := func(backoff time.Duration) bool {
 		if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
 			// we are past the deadline
@@ -890,7 +1258,7 @@ func (client *client) tryRefreshMetadata(topics []string, attemptsRemaining int,
 			}
 			Logger.Printf("client/metadata retrying after %dms... (%d attempts remaining)\n", backoff/time.Millisecond, attemptsRemaining)
 
-			return client.tryRefreshMetadata(topics, attemptsRemaining-1, deadline)
+			return client.tryRefreshMetadata(topics, attemptsRemaining-1, deadline, result)
 		}
 		return err
 	}
@@ -924,7 +1292,8 @@ func (client *client) tryRefreshMetadata(topics []string, attemptsRemaining int,
 		if err == nil {
 			allKnownMetaData := len(topics) == 0
 			// valid response, use it
-			shouldRetry, err := client.updateMetadata(response, allKnownMetaData)
+			shouldRetry, err := client.updateMetadata(response, allKnownMetaData, result)
+			result.topicError = err != nil
 			if shouldRetry {
 				Logger.Println("client/metadata found some partitions to be leaderless")
 				return retry(err) // note: err can be nil
@@ -946,6 +1315,7 @@ func (client *client) tryRefreshMetadata(topics []string, attemptsRemaining int,
 			}
 			// else remove that broker and try again
 			Logger.Printf("client/metadata got error from broker %d while fetching metadata: %v\n", broker.ID(), err)
+			brokerErrors = append(brokerErrors, err)
 			_ = broker.Close()
 			client.deregisterBroker(broker)
 		} else {
@@ -969,7 +1339,7 @@ func (client *client) tryRefreshMetadata(topics []string, attemptsRemaining int,
 }
 
 // if no fatal error, returns a list of topics that need retrying due to ErrLeaderNotAvailable
-func (client *client) updateMetadata(data *MetadataResponse, allKnownMetaData bool) (retry bool, err error) {
+func (client *client) updateMetadata(data *MetadataResponse, allKnownMetaData bool, result *refreshResult) (retry bool, err error) {
 	if client.Closed() {
 		return
 	}
@@ -986,6 +1356,8 @@ func (client *client) updateMetadata(data *MetadataResponse, allKnownMetaData bo
 
 	client.controllerID = data.ControllerID
 
+	topicErrors := make(TopicMetadataError)
+	previous := client.metadata
 	if allKnownMetaData {
 		client.metadata = make(map[string]map[int32]*PartitionMetadata)
 		client.metadataTopics = make(map[string]none)
@@ -998,9 +1370,13 @@ func (client *client) updateMetadata(data *MetadataResponse, allKnownMetaData bo
 		if _, exists := client.metadataTopics[topic.Name]; !exists {
 			client.metadataTopics[topic.Name] = none{}
 		}
+		oldCount := len(previous[topic.Name])
 		delete(client.metadata, topic.Name)
 		delete(client.cachedPartitionsResults, topic.Name)
 
+		if topic.Err != ErrNoError && topic.Err != ErrLeaderNotAvailable {
+			topicErrors[topic.Name] = topic.Err
+		}
 		switch topic.Err {
 		case ErrNoError:
 			// no-op
@@ -1019,6 +1395,12 @@ func (client *client) updateMetadata(data *MetadataResponse, allKnownMetaData bo
 			continue
 		}
 
+		// a topic with an error may report only part of its partitions
+		if client.conf.Metadata.OnPartitionCountChanged != nil && topic.Err == ErrNoError &&
+			oldCount > 0 && oldCount != len(topic.Partitions) {
+			result.countChanges = append(result.countChanges, partitionCountChange{topic.Name, int32(oldCount), int32(len(topic.Partitions))})
+		}
+
 		client.metadata[topic.Name] = make(map[int32]*PartitionMetadata, len(topic.Partitions))
 		for _, partition := range topic.Partitions {
 			client.metadata[topic.Name][partition.ID] = partition
@@ -1033,9 +1415,24 @@ func (client *client) updateMetadata(data *MetadataResponse, allKnownMetaData bo
 		client.cachedPartitionsResults[topic.Name] = partitionCache
 	}
 
+	if len(topicErrors) > 1 {
+		err = topicErrors
+	}
 	return
 }
 
+// refreshResult collects what a single metadata refresh found, for the
+// caller that started it.
+type refreshResult struct {
+	countChanges []partitionCountChange // to report to Metadata.OnPartitionCountChanged
+	topicError   bool                   // whether the error returned came from topics in the response
+}
+
+type partitionCountChange struct {
+	topic              string
+	oldCount, newCount int32
+}
+
 func (client *client) cachedCoordinator(consumerGroup string) *Broker {
 	client.lock.RLock()
 	defer client.lock.RUnlock()
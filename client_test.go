@@ -2,7 +2,11 @@ package sarama
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"net"
+	"reflect"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -142,6 +146,29 @@ func TestClientSeedBrokers(t *testing.T) {
 	safeClose(t, client)
 }
 
+func TestClientSeedBrokersSkipsDeadSeed(t *testing.T) {
+	deadSeed := NewMockBroker(t, 1)
+	deadSeed.Close()
+	liveSeed := NewMockBroker(t, 2)
+	defer liveSeed.Close()
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(liveSeed.Addr(), liveSeed.BrokerID())
+	liveSeed.Returns(metadataResponse)
+
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	client, err := NewClient([]string{deadSeed.Addr(), liveSeed.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	if len(client.Brokers()) != 1 {
+		t.Errorf("Expected 1 broker from the live seed, found %d", len(client.Brokers()))
+	}
+}
+
 func TestClientMetadata(t *testing.T) {
 	seedBroker := NewMockBroker(t, 1)
 	leader := NewMockBroker(t, 5)
@@ -162,6 +189,7 @@ func TestClientMetadata(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	seedBroker.Returns(metadataResponse)
 	topics, err := client.Topics()
 	if err != nil {
 		t.Error(err)
@@ -217,6 +245,458 @@ func TestClientMetadata(t *testing.T) {
 	safeClose(t, client)
 }
 
+func TestClientTopicsSorted(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	for _, topic := range []string{"topic_c", "topic_a", "topic_b"} {
+		metadataResponse.AddTopicPartition(topic, 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	}
+	seedBroker.Returns(metadataResponse)
+
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	seedBroker.Returns(metadataResponse)
+	topics, err := client.Topics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(topics, []string{"topic_a", "topic_b", "topic_c"}) {
+		t.Error("Client returned incorrect topics:", topics)
+	}
+}
+
+func TestClientTopicsRefreshesMetadata(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+
+	// without Metadata.Full nothing is fetched until the first call
+	config := NewTestConfig()
+	config.Metadata.Full = false
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse.AddTopicPartition("topic_a", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	metadataResponse.AddTopic("topic_b", ErrInvalidTopic)
+	seedBroker.Returns(metadataResponse)
+
+	topics, err := client.Topics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(topics, []string{"topic_a"}) {
+		t.Error("Expected only the topic without an error, got", topics)
+	}
+
+	seedBroker.Close()
+	if _, err := client.Topics(); !errors.Is(err, ErrOutOfBrokers) {
+		t.Error("Expected ErrOutOfBrokers once the cluster is unreachable, got", err)
+	}
+}
+
+func TestClientHasTopic(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	seedBroker.Returns(metadataResponse)
+
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	requests := len(seedBroker.History())
+	if !client.HasTopic("my_topic") {
+		t.Error("Expected my_topic to be cached")
+	}
+	if client.HasTopic("other_topic") {
+		t.Error("Expected other_topic not to be cached")
+	}
+	if len(seedBroker.History()) != requests {
+		t.Error("HasTopic should not query the cluster")
+	}
+}
+
+func TestClientOfflinePartitions(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	seedBroker.Returns(metadataResponse)
+
+	client, err := NewClient([]string{seedBroker.Addr()}, NewTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	metadataResponse.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	metadataResponse.AddTopicPartition("my_topic", 2, -1, nil, nil, nil, ErrLeaderNotAvailable)
+	metadataResponse.AddTopicPartition("my_topic", 1, -1, nil, nil, nil, ErrLeaderNotAvailable)
+	metadataResponse.AddTopicPartition("healthy_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	metadataResponse.AddTopic("broken_topic", ErrInvalidTopic)
+	seedBroker.SetHandlerByMap(map[string]MockResponse{"MetadataRequest": NewMockWrapper(metadataResponse)})
+
+	// the leaderless partitions and the broken topic must neither make the
+	// refresh retry nor hide the offline partitions
+	requests := len(seedBroker.History())
+	offline, err := client.OfflinePartitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshes := len(seedBroker.History()) - requests; refreshes != 1 {
+		t.Errorf("Expected a single metadata refresh, got %d", refreshes)
+	}
+	if len(offline) != 1 {
+		t.Fatalf("Expected offline partitions for 1 topic, got %v", offline)
+	}
+	if ids := offline["my_topic"]; len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("Expected partitions [1 2] of my_topic to be offline, got %v", ids)
+	}
+}
+
+func TestClientResolveSeedSRV(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	seedBroker.Returns(metadataResponse)
+
+	host, port, err := net.SplitHostPort(seedBroker.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(original func(string, string, string) (string, []*net.SRV, error)) {
+		lookupSRV = original
+	}(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_kafka._tcp.example.com" {
+			t.Errorf("Unexpected SRV lookup of %s", name)
+		}
+		return name, []*net.SRV{{Target: host, Port: uint16(portNum)}}, nil
+	}
+
+	config := NewTestConfig()
+	config.Net.ResolveSeedSRV = true
+	client, err := NewClient([]string{"_kafka._tcp.example.com"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	if len(seedBroker.History()) != 1 {
+		t.Error("Expected the metadata to be fetched from the resolved seed broker")
+	}
+}
+
+func TestClientResolveSeedSRVFailure(t *testing.T) {
+	defer func(original func(string, string, string) (string, []*net.SRV, error)) {
+		lookupSRV = original
+	}(lookupSRV)
+	lookups := 0
+	lookupErr := errors.New("lookup failure")
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		lookups++
+		return "", nil, lookupErr
+	}
+
+	config := NewTestConfig()
+	config.Net.ResolveSeedSRV = true
+	config.Metadata.Retry.Max = 1
+	config.Metadata.Retry.Backoff = 0
+	_, err := NewClient([]string{"_kafka._tcp.example.com"}, config)
+	if !errors.Is(err, lookupErr) {
+		t.Errorf("Expected the lookup error, got %v", err)
+	}
+	if lookups != 2 {
+		t.Errorf("Expected the lookup to be retried once, got %d lookups", lookups)
+	}
+}
+
+func TestClientBrokerStats(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+	leader := NewMockBroker(t, 5)
+	defer leader.Close()
+
+	metadataResponse := NewMockMetadataResponse(t).
+		SetBroker(leader.Addr(), leader.BrokerID()).
+		SetLeader("my_topic", 0, leader.BrokerID())
+	seedBroker.SetHandlerByMap(map[string]MockResponse{"MetadataRequest": metadataResponse})
+	leader.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest":    metadataResponse,
+		"ApiVersionsRequest": NewMockApiVersionsResponse(t),
+	})
+
+	client, err := NewClient([]string{seedBroker.Addr()}, NewTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	if stats := client.BrokerStats(); len(stats) != 1 || stats[5] != 0 {
+		t.Errorf("Expected no requests to have been sent to broker #5, got %v", stats)
+	}
+
+	broker, err := client.Broker(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := broker.GetMetadata(&MetadataRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := client.BrokerStats(); stats[5] != int64(len(leader.History())) {
+		t.Errorf("Expected %d requests to broker #5, got %v", len(leader.History()), stats)
+	}
+}
+
+func TestClientConcurrentTopicRefreshShared(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	seedBroker.SetLatency(100 * time.Millisecond)
+	seedBroker.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(seedBroker.Addr(), seedBroker.BrokerID()).
+			SetLeader("my_topic", 0, seedBroker.BrokerID()),
+	})
+
+	config := NewTestConfig()
+	config.Metadata.Full = false
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	before := len(seedBroker.History())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.RefreshMetadata("my_topic"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(seedBroker.History()) - before; n != 1 {
+		t.Errorf("Expected concurrent refreshes of one topic to share 1 metadata request, got %d", n)
+	}
+
+	if err := client.RefreshMetadata("my_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(seedBroker.History()) - before; n != 2 {
+		t.Errorf("Expected a later refresh to send its own metadata request, got %d in total", n)
+	}
+}
+
+func TestClientHealthCheck(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+
+	seedBroker.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(seedBroker.Addr(), seedBroker.BrokerID()),
+		"ApiVersionsRequest": NewMockApiVersionsResponse(t),
+	})
+
+	config := NewTestConfig()
+	config.Version = V0_10_0_0
+	config.Net.ReadTimeout = 100 * time.Millisecond
+	config.Metadata.Retry.Max = 0
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	if err := client.HealthCheck(); err != nil {
+		t.Error("Expected a healthy broker, got", err)
+	}
+
+	seedBroker.Close()
+
+	if err := client.HealthCheck(); err == nil {
+		t.Error("Expected the health check to fail once the broker is gone")
+	}
+}
+
+func TestClientAnyBrokerDeterministic(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+	brokers := map[int32]*MockBroker{}
+	for _, id := range []int32{5, 2, 7} {
+		brokers[id] = NewMockBroker(t, id)
+		defer brokers[id].Close()
+	}
+
+	metadataResponse := NewMockMetadataResponse(t)
+	for id, broker := range brokers {
+		metadataResponse.SetBroker(broker.Addr(), id)
+	}
+	seedBroker.SetHandlerByMap(map[string]MockResponse{"MetadataRequest": metadataResponse})
+
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	c, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, c)
+
+	client := c.(*client)
+	client.lock.Lock()
+	client.seedBrokers = nil
+	client.lock.Unlock()
+
+	for i := 0; i < 10; i++ {
+		if broker := client.anyBroker(); broker.ID() != 2 {
+			t.Fatalf("Expected the lowest broker ID 2, got %d", broker.ID())
+		}
+	}
+
+	// once broker 2 has been closed, an open connection is preferred
+	broker7, _ := client.Broker(7)
+	if broker2, _ := client.Broker(2); broker2 != nil {
+		_ = broker2.Close()
+	}
+	_ = broker7.Open(config)
+	if broker := client.anyBroker(); broker.ID() != 7 {
+		t.Errorf("Expected the connected broker 7, got %d", broker.ID())
+	}
+}
+
+func TestClientMultiTopicRefreshErrors(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse.AddTopic("missing_topic", ErrUnknownTopicOrPartition)
+	metadataResponse.AddTopic("secret_topic", ErrTopicAuthorizationFailed)
+	metadataResponse.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	seedBroker.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockWrapper(metadataResponse),
+	})
+
+	config := NewTestConfig()
+	config.Metadata.Full = false
+	config.Metadata.Retry.Max = 0
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	err = client.RefreshMetadata("missing_topic", "secret_topic", "my_topic")
+	var topicErrors TopicMetadataError
+	if !errors.As(err, &topicErrors) {
+		t.Fatalf("Expected a TopicMetadataError, got %v", err)
+	}
+	expected := TopicMetadataError{"missing_topic": ErrUnknownTopicOrPartition, "secret_topic": ErrTopicAuthorizationFailed}
+	if !reflect.DeepEqual(topicErrors, expected) {
+		t.Errorf("Expected %v, got %v", expected, topicErrors)
+	}
+	if !errors.Is(err, ErrTopicAuthorizationFailed) {
+		t.Error("Expected the error to match each topic's error")
+	}
+	if !client.HasTopic("my_topic") {
+		t.Error("Expected the healthy topic to be stored")
+	}
+}
+
+func TestClientFailedTopicRefreshBackoff(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse.AddTopic("missing_topic", ErrUnknownTopicOrPartition)
+	seedBroker.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockWrapper(metadataResponse),
+	})
+
+	config := NewTestConfig()
+	config.Metadata.Full = false
+	config.Metadata.Retry.Max = 0
+	config.Metadata.TopicRefreshBackoff = time.Hour
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	before := len(seedBroker.History())
+	for i := 0; i < 3; i++ {
+		if err := client.RefreshMetadata("missing_topic"); !errors.Is(err, ErrUnknownTopicOrPartition) {
+			t.Errorf("Expected ErrUnknownTopicOrPartition, got %v", err)
+		}
+	}
+	if n := len(seedBroker.History()) - before; n != 1 {
+		t.Errorf("Expected a failed topic refresh to be reused, got %d metadata requests", n)
+	}
+}
+
+func TestClientTransientTopicRefreshFailureNotRemembered(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+
+	config := NewTestConfig()
+	config.Metadata.Full = false
+	config.Metadata.Retry.Max = 0
+	config.Metadata.TopicRefreshBackoff = time.Hour
+	c, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, c)
+
+	// the only broker goes away
+	seedBroker.Close()
+	if err := c.RefreshMetadata("my_topic"); !errors.Is(err, ErrOutOfBrokers) {
+		t.Fatalf("Expected ErrOutOfBrokers, got %v", err)
+	}
+
+	client := c.(*client)
+	client.refreshLock.Lock()
+	_, remembered := client.refreshes["my_topic"]
+	client.refreshLock.Unlock()
+	if remembered {
+		t.Error("Expected a transient refresh failure not to be remembered")
+	}
+}
+
 func TestClientMetadataWithOfflineReplicas(t *testing.T) {
 	seedBroker := NewMockBroker(t, 1)
 	leader := NewMockBroker(t, 5)
@@ -241,6 +721,7 @@ func TestClientMetadataWithOfflineReplicas(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	seedBroker.Returns(metadataResponse)
 	topics, err := client.Topics()
 	if err != nil {
 		t.Error(err)
@@ -481,6 +962,255 @@ func TestClientReceivingPartialMetadata(t *testing.T) {
 	leader.Close()
 }
 
+func TestClientLeaderNotElected(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	// a leader ID of -1 means the partition exists but has no leader right now
+	metadataResponse := new(MetadataResponse)
+	metadataResponse.AddTopicPartition("my_topic", 0, -1, nil, nil, nil, ErrNoError)
+	seedBroker.Returns(metadataResponse)
+
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	// asking for the leader triggers a refresh, which still has no leader
+	seedBroker.Returns(metadataResponse)
+
+	_, err = client.Leader("my_topic", 0)
+	if !errors.Is(err, ErrLeaderNotAvailable) {
+		t.Error("Expected ErrLeaderNotAvailable, got", err)
+	}
+}
+
+func TestClientWaitForLeader(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	noLeader := new(MetadataResponse)
+	noLeader.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	noLeader.AddTopicPartition("my_topic", 0, -1, nil, nil, nil, ErrNoError)
+	seedBroker.Returns(noLeader)
+
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	config.Metadata.Retry.Backoff = 10 * time.Millisecond
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	// the partition only gets a leader on the second refresh
+	seedBroker.Returns(noLeader)
+	elected := new(MetadataResponse)
+	elected.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	elected.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	seedBroker.Returns(elected)
+
+	if err := client.WaitForLeader("my_topic", 0, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// partition 1 never gets a leader
+	elected.AddTopicPartition("my_topic", 1, -1, nil, nil, nil, ErrNoError)
+	seedBroker.SetHandlerByMap(map[string]MockResponse{"MetadataRequest": NewMockWrapper(elected)})
+	if err := client.WaitForLeader("my_topic", 1, 50*time.Millisecond); !errors.Is(err, ErrLeaderNotAvailable) {
+		t.Error("Expected ErrLeaderNotAvailable after the timeout, got", err)
+	}
+}
+
+func TestClientWaitForLeaderBackoff(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	noLeader := new(MetadataResponse)
+	noLeader.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	noLeader.AddTopicPartition("my_topic", 0, -1, nil, nil, nil, ErrNoError)
+	seedBroker.SetHandlerByMap(map[string]MockResponse{"MetadataRequest": NewMockWrapper(noLeader)})
+
+	var backoffCalls int32
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	config.Metadata.Retry.BackoffFunc = func(retries, maxRetries int) time.Duration {
+		atomic.AddInt32(&backoffCalls, 1)
+		return 0
+	}
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	requests := len(seedBroker.History())
+	if err := client.WaitForLeader("my_topic", 0, 200*time.Millisecond); !errors.Is(err, ErrLeaderNotAvailable) {
+		t.Error("Expected ErrLeaderNotAvailable after the timeout, got", err)
+	}
+	if atomic.LoadInt32(&backoffCalls) == 0 {
+		t.Error("Expected Metadata.Retry.BackoffFunc to be used")
+	}
+	// a zero backoff is raised to the minimum wait between attempts
+	if refreshes := len(seedBroker.History()) - requests; refreshes > 6 {
+		t.Errorf("Expected at most 6 metadata refreshes in 200ms, got %d", refreshes)
+	}
+}
+
+func TestClientWaitForLeaderTimeoutWithDefaultRetries(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	noLeader := new(MetadataResponse)
+	noLeader.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	noLeader.AddTopicPartition("my_topic", 0, -1, nil, nil, nil, ErrNoError)
+	seedBroker.SetHandlerByMap(map[string]MockResponse{"MetadataRequest": NewMockWrapper(noLeader)})
+
+	client, err := NewClient([]string{seedBroker.Addr()}, NewTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	requests := len(seedBroker.History())
+	start := time.Now()
+	if err := client.WaitForLeader("my_topic", 0, 100*time.Millisecond); !errors.Is(err, ErrLeaderNotAvailable) {
+		t.Error("Expected ErrLeaderNotAvailable after the timeout, got", err)
+	}
+	// a leaderless partition must not make an attempt run the Metadata.Retry chain
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected WaitForLeader to honour its 100ms timeout, it took %v", elapsed)
+	}
+	if refreshes := len(seedBroker.History()) - requests; refreshes != 1 {
+		t.Errorf("Expected a single metadata refresh, got %d", refreshes)
+	}
+}
+
+func TestClientPartitionCountChanged(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse1 := new(MetadataResponse)
+	metadataResponse1.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse1.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	seedBroker.Returns(metadataResponse1)
+
+	metadataResponse2 := new(MetadataResponse)
+	metadataResponse2.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	for partition := int32(0); partition < 3; partition++ {
+		metadataResponse2.AddTopicPartition("my_topic", partition, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	}
+	seedBroker.Returns(metadataResponse2)
+
+	var changes []string
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	config.Metadata.OnPartitionCountChanged = func(topic string, oldCount, newCount int32) {
+		changes = append(changes, fmt.Sprintf("%s:%d->%d", topic, oldCount, newCount))
+	}
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	if len(changes) != 0 {
+		t.Error("Expected no callback for newly discovered topics, got", changes)
+	}
+
+	if err := client.RefreshMetadata("my_topic"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, []string{"my_topic:1->3"}) {
+		t.Error("Expected one partition count change for my_topic, got", changes)
+	}
+}
+
+func TestClientPartitionCountChangedRefreshFromCallback(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse1 := new(MetadataResponse)
+	metadataResponse1.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse1.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	seedBroker.Returns(metadataResponse1)
+
+	metadataResponse2 := new(MetadataResponse)
+	metadataResponse2.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse2.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	metadataResponse2.AddTopicPartition("my_topic", 1, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	seedBroker.Returns(metadataResponse2)
+	seedBroker.Returns(metadataResponse2)
+
+	var client Client
+	refreshed := make(chan error, 1)
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	config.Metadata.OnPartitionCountChanged = func(topic string, oldCount, newCount int32) {
+		refreshed <- client.RefreshMetadata(topic)
+	}
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	done := make(chan error, 1)
+	go func() { done <- client.RefreshMetadata("my_topic") }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RefreshMetadata deadlocked on the refresh from the callback")
+	}
+	select {
+	case err := <-refreshed:
+		if err != nil {
+			t.Error(err)
+		}
+	default:
+		t.Error("Expected the callback to have been called")
+	}
+}
+
+func TestClientPartitionCountChangedIgnoresTopicErrors(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	metadataResponse1 := new(MetadataResponse)
+	metadataResponse1.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse1.AddTopicPartition("my_topic", 0, seedBroker.BrokerID(), nil, nil, nil, ErrNoError)
+	seedBroker.Returns(metadataResponse1)
+
+	metadataResponse2 := new(MetadataResponse)
+	metadataResponse2.AddBroker(seedBroker.Addr(), seedBroker.BrokerID())
+	metadataResponse2.AddTopic("my_topic", ErrLeaderNotAvailable)
+	seedBroker.Returns(metadataResponse2)
+
+	var changes []string
+	config := NewTestConfig()
+	config.Metadata.Retry.Max = 0
+	config.Metadata.OnPartitionCountChanged = func(topic string, oldCount, newCount int32) {
+		changes = append(changes, fmt.Sprintf("%s:%d->%d", topic, oldCount, newCount))
+	}
+	client, err := NewClient([]string{seedBroker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	_ = client.RefreshMetadata("my_topic")
+	if len(changes) != 0 {
+		t.Error("Expected no partition count change for a topic-level error, got", changes)
+	}
+}
+
 func TestClientRefreshBehaviour(t *testing.T) {
 	seedBroker := NewMockBroker(t, 1)
 	leader := NewMockBroker(t, 5)
@@ -985,6 +1715,73 @@ func TestClientCoordinatorWithoutConsumerOffsetsTopic(t *testing.T) {
 	safeClose(t, client)
 }
 
+func TestClientBackgroundRefreshDeferredByManualRefresh(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	seedBroker.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t),
+	})
+
+	conf := NewTestConfig()
+	conf.Metadata.RefreshFrequency = 500 * time.Millisecond
+	client, err := NewClient([]string{seedBroker.Addr()}, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	time.Sleep(300 * time.Millisecond)
+	if err := client.RefreshMetadata(); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the manual refresh the background updater would have fired at
+	// 500ms, instead it should now wait until around 800ms
+	time.Sleep(350 * time.Millisecond)
+	if requests := len(seedBroker.History()); requests != 2 {
+		t.Errorf("Expected 2 metadata requests, found %d", requests)
+	}
+}
+
+func TestClientBackgroundRefreshNotDeferredBySingleTopicRefresh(t *testing.T) {
+	seedBroker := NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	seedBroker.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(seedBroker.Addr(), seedBroker.BrokerID()).
+			SetLeader("my_topic", 0, seedBroker.BrokerID()),
+	})
+
+	conf := NewTestConfig()
+	conf.Metadata.RefreshFrequency = 300 * time.Millisecond
+	client, err := NewClient([]string{seedBroker.Addr()}, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	// refreshing one topic more often than RefreshFrequency must not keep
+	// postponing the refresh of all topics
+	for i := 0; i < 14; i++ {
+		if err := client.RefreshMetadata("my_topic"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	fullRefreshes := 0
+	for _, rr := range seedBroker.History() {
+		if req, ok := rr.Request.(*MetadataRequest); ok && len(req.Topics) == 0 {
+			fullRefreshes++
+		}
+	}
+	if fullRefreshes < 2 {
+		t.Errorf("Expected the background updater to refresh all topics, found %d full refreshes", fullRefreshes)
+	}
+}
+
 func TestClientAutorefreshShutdownRace(t *testing.T) {
 	seedBroker := NewMockBroker(t, 1)
 	defer seedBroker.Close()
@@ -50,6 +50,17 @@ type Config struct {
 		ReadTimeout  time.Duration // How long to wait for a response.
 		WriteTimeout time.Duration // How long to wait for a transmit.
 
+		// Connections that take longer than this to establish, TCP connect
+		// and TLS handshake included, are logged as slow, to tell network or
+		// DNS slowness apart from slow request processing. The time taken by
+		// every connection is also recorded in the connect-latency-in-ms
+		// metric. Defaults to 0, which disables the log.
+		SlowDialThreshold time.Duration
+
+		// The size in bytes of the buffer responses are read through, so that
+		// large fetch responses take fewer reads (default 64 KiB).
+		ReadBufferSize int
+
 		TLS struct {
 			// Whether or not to use TLS when connecting to the broker
 			// (defaults to false).
@@ -110,6 +121,12 @@ type Config struct {
 		// If nil, a local address is automatically chosen.
 		LocalAddr net.Addr
 
+		// Whether to treat each address passed to NewClient as the name of a
+		// DNS SRV record, such as "_kafka._tcp.example.com", and use the
+		// host:port targets it resolves to as the seed brokers (defaults to
+		// false). Failed lookups are retried as configured by Metadata.Retry.
+		ResolveSeedSRV bool
+
 		Proxy struct {
 			// Whether or not to use proxy when connecting to the broker
 			// (defaults to false).
@@ -131,14 +148,29 @@ type Config struct {
 			Backoff time.Duration
 			// Called to compute backoff time dynamically. Useful for implementing
 			// more sophisticated backoff strategies. This takes precedence over
-			// `Backoff` if set.
+			// `Backoff` if set. retries is 0 for the first retry. See
+			// NewExponentialBackoff for a ready-made exponential strategy, and
+			// NewJitteredBackoff to spread the retries of many clients apart.
 			BackoffFunc func(retries, maxRetries int) time.Duration
 		}
 		// How frequently to refresh the cluster metadata in the background.
 		// Defaults to 10 minutes. Set to 0 to disable. Similar to
-		// `topic.metadata.refresh.interval.ms` in the JVM version.
+		// `topic.metadata.refresh.interval.ms` in the JVM version. A successful
+		// refresh triggered elsewhere that covers every topic the background
+		// refresh would (all topics, or with Metadata.Full disabled at least
+		// every tracked topic) pushes the next background refresh back by this
+		// interval; other refreshes leave it alone.
 		RefreshFrequency time.Duration
 
+		// How long a metadata refresh of a single topic that failed because of
+		// the topic itself (unknown, invalid or unauthorized) is remembered.
+		// Until it elapses, further refreshes of that topic fail with the same
+		// error without querying the cluster, so repeated lookups of a missing
+		// topic are not each sent to the brokers. Transient failures, such as
+		// network errors or running out of brokers, are never remembered.
+		// Defaults to 0, which disables this.
+		TopicRefreshBackoff time.Duration
+
 		// Whether to maintain a full set of metadata for all topics, or just
 		// the minimal set that has been necessary so far. The full set is simpler
 		// and usually more convenient, but can take up a substantial amount of
@@ -152,6 +184,13 @@ type Config struct {
 		// to fail.
 		Timeout time.Duration
 
+		// Called after a metadata refresh finds that a cached topic now has a
+		// different number of partitions, for example after partitions were
+		// added to it. Each change is reported once, from the goroutine whose
+		// refresh found it, after that refresh has completed, so it may call
+		// back into the client, but it must not block for long. Defaults to nil.
+		OnPartitionCountChanged func(topic string, oldCount, newCount int32)
+
 		// Whether to allow auto-create topics in metadata refresh. If set to true,
 		// the broker may auto-create topics that we requested which do not already exist,
 		// if it is configured to do so (`auto.create.topics.enable` is true). Defaults to true.
@@ -234,7 +273,7 @@ type Config struct {
 			Backoff time.Duration
 			// Called to compute backoff time dynamically. Useful for implementing
 			// more sophisticated backoff strategies. This takes precedence over
-			// `Backoff` if set.
+			// `Backoff` if set. retries is 1 for the first retry of a message.
 			BackoffFunc func(retries, maxRetries int) time.Duration
 		}
 
@@ -304,8 +343,9 @@ type Config struct {
 			// if the fetched consumer offset is out of range of available offsets. Out of range
 			// can happen if the data has been deleted from the server, or during situations of
 			// under-replication where a replica does not have all the data yet. It can be
-			// dangerous to reset the offset automatically, particularly in the latter case. Defaults
-			// to true to maintain existing behavior.
+			// dangerous to reset the offset automatically, particularly in the latter case. This only
+			// applies to the offset a claim starts consuming from, see Consumer.Offsets.ResetPolicy
+			// for offsets that go out of range while consuming. Defaults to false.
 			ResetInvalidOffsets bool
 		}
 
@@ -346,7 +386,9 @@ type Config struct {
 		// default is 250ms, since 0 causes the consumer to spin when no events are
 		// available. 100-500ms is a reasonable range for most cases. Kafka only
 		// supports precision up to milliseconds; nanoseconds will be truncated.
-		// Equivalent to the JVM's `fetch.wait.max.ms`.
+		// Equivalent to the JVM's `fetch.wait.max.ms`. As the broker may hold a
+		// fetch for this long before answering, it is added to Net.ReadTimeout
+		// when waiting for the response to a fetch.
 		MaxWaitTime time.Duration
 
 		// The maximum amount of time the consumer expects a message takes to
@@ -399,6 +441,14 @@ type Config struct {
 			// Should be OffsetNewest or OffsetOldest. Defaults to OffsetNewest.
 			Initial int64
 
+			// What a partition consumer does when a fetch reports its offset
+			// as out of range while consuming, typically because the log was
+			// truncated by retention. OffsetResetEarliest and OffsetResetLatest
+			// resume from the oldest and newest available offset respectively.
+			// OffsetResetNone (the default) returns ErrOffsetOutOfRange on the
+			// Errors channel and stops the partition consumer.
+			ResetPolicy OffsetResetPolicy
+
 			// The retention duration for committed offsets. If zero, disabled
 			// (in which case the `offsets.retention.minutes` option on the
 			// broker will be used).  Kafka only supports precision up to
@@ -426,6 +476,17 @@ type Config struct {
 		// passed to the second interceptor OnConsume(), and so on in the
 		// interceptor chain.
 		Interceptors []ConsumerInterceptor
+
+		// Called with the offset of the last message of each fetched batch
+		// once every message of that batch has been sent to the messages
+		// channel, for applications that store their offsets outside of
+		// Kafka. It is called synchronously from the partition consumer, so
+		// blocking in it throttles consumption of that partition. It is called
+		// after the batch is acknowledged to the broker consumer, but the next
+		// fetch from a broker waits for every partition it leads, so blocking
+		// for longer than a fetch round trip also delays the other partitions
+		// on that broker. Nil (the default) disables it.
+		OnOffsetAdvanced func(topic string, partition int32, offset int64)
 	}
 
 	// A user-provided string sent with every request to the brokers for logging,
@@ -473,6 +534,7 @@ func NewConfig() *Config {
 	c.Net.DialTimeout = 30 * time.Second
 	c.Net.ReadTimeout = 30 * time.Second
 	c.Net.WriteTimeout = 30 * time.Second
+	c.Net.ReadBufferSize = 64 * 1024
 	c.Net.SASL.Handshake = true
 	c.Net.SASL.Version = SASLHandshakeV0
 
@@ -583,6 +645,8 @@ func (c *Config) Validate() error {
 		return ConfigurationError("Net.ReadTimeout must be > 0")
 	case c.Net.WriteTimeout <= 0:
 		return ConfigurationError("Net.WriteTimeout must be > 0")
+	case c.Net.ReadBufferSize <= 0:
+		return ConfigurationError("Net.ReadBufferSize must be > 0")
 	case c.Net.SASL.Enable:
 		if c.Net.SASL.Mechanism == "" {
 			c.Net.SASL.Mechanism = SASLTypePlaintext
@@ -658,6 +722,8 @@ func (c *Config) Validate() error {
 		return ConfigurationError("Metadata.Retry.Backoff must be >= 0")
 	case c.Metadata.RefreshFrequency < 0:
 		return ConfigurationError("Metadata.RefreshFrequency must be >= 0")
+	case c.Metadata.TopicRefreshBackoff < 0:
+		return ConfigurationError("Metadata.TopicRefreshBackoff must be >= 0")
 	}
 
 	// validate the Producer values
@@ -684,6 +750,8 @@ func (c *Config) Validate() error {
 		return ConfigurationError("Producer.Retry.Max must be >= 0")
 	case c.Producer.Retry.Backoff < 0:
 		return ConfigurationError("Producer.Retry.Backoff must be >= 0")
+	case c.Producer.Compression < CompressionNone || c.Producer.Compression > CompressionZSTD:
+		return ConfigurationError("Producer.Compression must be a supported CompressionCodec")
 	}
 
 	if c.Producer.Compression == CompressionLZ4 && !c.Version.IsAtLeast(V0_10_0_0) {
@@ -737,6 +805,9 @@ func (c *Config) Validate() error {
 		return ConfigurationError("Consumer.Offsets.Initial must be OffsetOldest or OffsetNewest")
 	case c.Consumer.Offsets.Retry.Max < 0:
 		return ConfigurationError("Consumer.Offsets.Retry.Max must be >= 0")
+	case c.Consumer.Offsets.ResetPolicy != OffsetResetNone && c.Consumer.Offsets.ResetPolicy != OffsetResetEarliest &&
+		c.Consumer.Offsets.ResetPolicy != OffsetResetLatest:
+		return ConfigurationError("Consumer.Offsets.ResetPolicy must be OffsetResetNone, OffsetResetEarliest or OffsetResetLatest")
 	case c.Consumer.IsolationLevel != ReadUncommitted && c.Consumer.IsolationLevel != ReadCommitted:
 		return ConfigurationError("Consumer.IsolationLevel must be ReadUncommitted or ReadCommitted")
 	}
@@ -79,6 +79,13 @@ func TestNetConfigValidates(t *testing.T) {
 			},
 			"Net.WriteTimeout must be > 0",
 		},
+		{
+			"ReadBufferSize",
+			func(cfg *Config) {
+				cfg.Net.ReadBufferSize = 0
+			},
+			"Net.ReadBufferSize must be > 0",
+		},
 		{
 			"SASL.User",
 			func(cfg *Config) {
@@ -392,6 +399,13 @@ func TestProducerConfigValidates(t *testing.T) {
 			},
 			"Producer.Retry.Backoff must be >= 0",
 		},
+		{
+			"Compression",
+			func(cfg *Config) {
+				cfg.Producer.Compression = CompressionCodec(7)
+			},
+			"Producer.Compression must be a supported CompressionCodec",
+		},
 		{
 			"Idempotent Version",
 			func(cfg *Config) {
@@ -461,6 +475,13 @@ func TestConsumerConfigValidates(t *testing.T) {
 			},
 			"Consumer.IsolationLevel must be ReadUncommitted or ReadCommitted",
 		},
+		{
+			"Incorrect offset reset policy",
+			func(cfg *Config) {
+				cfg.Consumer.Offsets.ResetPolicy = OffsetResetPolicy(42)
+			},
+			"Consumer.Offsets.ResetPolicy must be OffsetResetNone, OffsetResetEarliest or OffsetResetLatest",
+		},
 	}
 
 	for i, test := range tests {
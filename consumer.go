@@ -16,6 +16,7 @@ type ConsumerMessage struct {
 	Headers        []*RecordHeader // only set if kafka is version 0.11+
 	Timestamp      time.Time       // only set if kafka is version 0.10+, inner message timestamp
 	BlockTimestamp time.Time       // only set if kafka is version 0.10+, outer (compressed) block timestamp
+	LogAppendTime  bool            // only set if kafka is version 0.10+, Timestamp is the broker's append time rather than the producer's create time
 
 	Key, Value []byte
 	Topic      string
@@ -52,8 +53,8 @@ func (ce ConsumerErrors) Error() string {
 // on a consumer to avoid leaks, it will not be garbage-collected automatically when it passes out of
 // scope.
 type Consumer interface {
-	// Topics returns the set of available topics as retrieved from the cluster
-	// metadata. This method is the same as Client.Topics(), and is provided for
+	// Topics refreshes the cluster metadata and returns the sorted set of
+	// available topics. This method is the same as Client.Topics(), and is provided for
 	// convenience.
 	Topics() ([]string, error)
 
@@ -411,9 +412,24 @@ type partitionConsumer struct {
 	offset         int64
 	retries        int32
 
+	offsetOutOfRange bool // set before redispatching a child whose offset must be reset
+
 	paused int32
 }
 
+// OffsetResetPolicy selects what a partition consumer does when its offset
+// is reported as out of range while consuming.
+type OffsetResetPolicy int8
+
+const (
+	// OffsetResetNone stops the partition consumer with ErrOffsetOutOfRange.
+	OffsetResetNone OffsetResetPolicy = iota
+	// OffsetResetEarliest resumes from the oldest available offset.
+	OffsetResetEarliest
+	// OffsetResetLatest resumes from the newest available offset.
+	OffsetResetLatest
+)
+
 var errTimedOut = errors.New("timed out feeding messages to the user") // not user-facing
 
 func (child *partitionConsumer) sendError(err error) {
@@ -449,7 +465,11 @@ func (child *partitionConsumer) dispatcher() {
 				child.broker = nil
 			}
 
-			if err := child.dispatch(); err != nil {
+			err := child.resetOffset()
+			if err == nil {
+				err = child.dispatch()
+			}
+			if err != nil {
 				child.sendError(err)
 				child.trigger <- none{}
 			}
@@ -500,6 +520,28 @@ func (child *partitionConsumer) dispatch() error {
 	return nil
 }
 
+// resetOffset moves a child whose offset went out of range to the offset
+// picked by Consumer.Offsets.ResetPolicy.
+func (child *partitionConsumer) resetOffset() error {
+	if !child.offsetOutOfRange {
+		return nil
+	}
+
+	offset := OffsetOldest
+	if child.conf.Consumer.Offsets.ResetPolicy == OffsetResetLatest {
+		offset = OffsetNewest
+	}
+	newOffset, err := child.consumer.client.GetOffset(child.topic, child.partition, offset)
+	if err != nil {
+		return err
+	}
+
+	Logger.Printf("consumer/%s/%d offset %d is out of range, resetting to %d\n", child.topic, child.partition, child.offset, newOffset)
+	child.offset = newOffset
+	child.offsetOutOfRange = false
+	return nil
+}
+
 func (child *partitionConsumer) chooseStartingOffset(offset int64) error {
 	newestOffset, err := child.consumer.client.GetOffset(child.topic, child.partition, OffsetNewest)
 	if err != nil {
@@ -589,15 +631,20 @@ feederLoop:
 				if !firstAttempt {
 					child.responseResult = errTimedOut
 					child.broker.acks.Done()
+					delivered := true
 				remainingLoop:
 					for _, msg = range msgs[i:] {
 						child.interceptors(msg)
 						select {
 						case child.messages <- msg:
 						case <-child.dying:
+							delivered = false
 							break remainingLoop
 						}
 					}
+					if delivered {
+						child.offsetAdvanced(msgs)
+					}
 					child.broker.input <- child
 					continue feederLoop
 				} else {
@@ -610,6 +657,7 @@ feederLoop:
 		}
 
 		child.broker.acks.Done()
+		child.offsetAdvanced(msgs)
 	}
 
 	expiryTicker.Stop()
@@ -623,11 +671,13 @@ func (child *partitionConsumer) parseMessages(msgSet *MessageSet) ([]*ConsumerMe
 		for _, msg := range msgBlock.Messages() {
 			offset := msg.Offset
 			timestamp := msg.Msg.Timestamp
+			logAppendTime := false
 			if msg.Msg.Version >= 1 {
 				baseOffset := msgBlock.Offset - msgBlock.Messages()[len(msgBlock.Messages())-1].Offset
 				offset += baseOffset
 				if msg.Msg.LogAppendTime {
 					timestamp = msgBlock.Msg.Timestamp
+					logAppendTime = true
 				}
 			}
 			if offset < child.offset {
@@ -641,6 +691,7 @@ func (child *partitionConsumer) parseMessages(msgSet *MessageSet) ([]*ConsumerMe
 				Offset:         offset,
 				Timestamp:      timestamp,
 				BlockTimestamp: msgBlock.Msg.Timestamp,
+				LogAppendTime:  logAppendTime,
 			})
 			child.offset = offset + 1
 		}
@@ -664,13 +715,14 @@ func (child *partitionConsumer) parseRecords(batch *RecordBatch) ([]*ConsumerMes
 			timestamp = batch.MaxTimestamp
 		}
 		messages = append(messages, &ConsumerMessage{
-			Topic:     child.topic,
-			Partition: child.partition,
-			Key:       rec.Key,
-			Value:     rec.Value,
-			Offset:    offset,
-			Timestamp: timestamp,
-			Headers:   rec.Headers,
+			Topic:         child.topic,
+			Partition:     child.partition,
+			Key:           rec.Key,
+			Value:         rec.Value,
+			Offset:        offset,
+			Timestamp:     timestamp,
+			LogAppendTime: batch.LogAppendTime,
+			Headers:       rec.Headers,
 		})
 		child.offset = offset + 1
 	}
@@ -834,6 +886,13 @@ func (child *partitionConsumer) interceptors(msg *ConsumerMessage) {
 	}
 }
 
+func (child *partitionConsumer) offsetAdvanced(msgs []*ConsumerMessage) {
+	if child.conf.Consumer.OnOffsetAdvanced == nil || len(msgs) == 0 {
+		return
+	}
+	child.conf.Consumer.OnOffsetAdvanced(child.topic, child.partition, msgs[len(msgs)-1].Offset)
+}
+
 // Pause implements PartitionConsumer.
 func (child *partitionConsumer) Pause() {
 	atomic.StoreInt32(&child.paused, 1)
@@ -1008,6 +1067,13 @@ func (bc *brokerConsumer) handleResponses() {
 			Logger.Printf("consumer/broker/%d abandoned subscription to %s/%d because consuming was taking too long\n",
 				bc.broker.ID(), child.topic, child.partition)
 			delete(bc.subscriptions, child)
+		} else if errors.Is(result, ErrOffsetOutOfRange) && child.conf.Consumer.Offsets.ResetPolicy != OffsetResetNone {
+			// the log was truncated under us, redispatch from the offset picked by the reset policy
+			Logger.Printf("consumer/broker/%d abandoned subscription to %s/%d because %s\n",
+				bc.broker.ID(), child.topic, child.partition, result)
+			child.offsetOutOfRange = true
+			child.trigger <- none{}
+			delete(bc.subscriptions, child)
 		} else if errors.Is(result, ErrOffsetOutOfRange) {
 			// there's no point in retrying this it will just fail the same way again
 			// shut it down and force the user to choose what to do
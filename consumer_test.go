@@ -80,6 +80,69 @@ func TestConsumerOffsetManual(t *testing.T) {
 	broker0.Close()
 }
 
+func TestConsumerOnOffsetAdvanced(t *testing.T) {
+	// Given
+	broker0 := NewMockBroker(t, 0)
+	defer broker0.Close()
+
+	mockFetchResponse := NewMockFetchResponse(t, 3)
+	for i := int64(0); i < 6; i++ {
+		mockFetchResponse.SetMessage("my_topic", 0, i, testMsg)
+	}
+
+	broker0.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()),
+		"OffsetRequest": NewMockOffsetResponse(t).
+			SetOffset("my_topic", 0, OffsetOldest, 0).
+			SetOffset("my_topic", 0, OffsetNewest, 6),
+		"FetchRequest": mockFetchResponse,
+	})
+
+	advanced := make(chan int64, 10)
+	config := NewTestConfig()
+	config.Consumer.OnOffsetAdvanced = func(topic string, partition int32, offset int64) {
+		if topic != "my_topic" || partition != 0 {
+			t.Errorf("Unexpected partition %s/%d", topic, partition)
+		}
+		advanced <- offset
+	}
+
+	// When
+	master, err := NewConsumer([]string{broker0.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, master)
+
+	consumer, err := master.ConsumePartition("my_topic", 0, OffsetOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, consumer)
+
+	// Then
+	for i := int64(0); i < 6; i++ {
+		select {
+		case message := <-consumer.Messages():
+			assertMessageOffset(t, message, i)
+		case err := <-consumer.Errors():
+			t.Error(err)
+		}
+	}
+	for _, expected := range []int64{2, 5} {
+		select {
+		case offset := <-advanced:
+			if offset != expected {
+				t.Errorf("Expected offset %d to be reported, got %d", expected, offset)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for offset %d to be reported", expected)
+		}
+	}
+}
+
 // If a message is given a key, it can be correctly collected while consuming.
 func TestConsumerMessageWithKey(t *testing.T) {
 	// Given
@@ -623,6 +686,65 @@ func TestConsumerShutsDownOutOfRange(t *testing.T) {
 	broker0.Close()
 }
 
+// If the offset goes out of range while consuming, then the partition consumer
+// resumes from the offset picked by Consumer.Offsets.ResetPolicy.
+func TestConsumerResetsOutOfRangeOffset(t *testing.T) {
+	for _, d := range []struct {
+		policy         OffsetResetPolicy
+		expectedOffset int64
+	}{
+		{OffsetResetEarliest, 7},
+		{OffsetResetLatest, 1234},
+	} {
+		// Given
+		broker0 := NewMockBroker(t, 0)
+		outOfRange := new(FetchResponse)
+		outOfRange.AddError("my_topic", 0, ErrOffsetOutOfRange)
+		broker0.SetHandlerByMap(map[string]MockResponse{
+			"MetadataRequest": NewMockMetadataResponse(t).
+				SetBroker(broker0.Addr(), broker0.BrokerID()).
+				SetLeader("my_topic", 0, broker0.BrokerID()),
+			"OffsetRequest": NewMockOffsetResponse(t).
+				SetOffset("my_topic", 0, OffsetNewest, 1234).
+				SetOffset("my_topic", 0, OffsetOldest, 7),
+			"FetchRequest": NewMockSequence(
+				NewMockWrapper(outOfRange),
+				NewMockFetchResponse(t, 1).
+					SetMessage("my_topic", 0, 7, testMsg).
+					SetMessage("my_topic", 0, 1234, testMsg),
+			),
+		})
+
+		config := NewTestConfig()
+		config.Consumer.Return.Errors = true
+		config.Consumer.Offsets.ResetPolicy = d.policy
+		master, err := NewConsumer([]string{broker0.Addr()}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// When
+		consumer, err := master.ConsumePartition("my_topic", 0, 101)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Then
+		select {
+		case msg := <-consumer.Messages():
+			assertMessageOffset(t, msg, d.expectedOffset)
+		case err := <-consumer.Errors():
+			t.Error(err)
+		case <-time.After(5 * time.Second):
+			t.Error("Timed out waiting for the consumer to reset its offset")
+		}
+
+		safeClose(t, consumer)
+		safeClose(t, master)
+		broker0.Close()
+	}
+}
+
 // If a fetch response contains messages with offsets that are smaller then
 // requested, then such messages are ignored.
 func TestConsumerExtraOffsets(t *testing.T) {
@@ -1789,6 +1911,10 @@ func TestConsumerTimestamps(t *testing.T) {
 					t.Errorf("Wrong timestamp (kversion:%v, logAppendTime:%v): got: %v, want: %v",
 						d.kversion, d.logAppendTime, msg.Timestamp, ts)
 				}
+				if msg.LogAppendTime != d.logAppendTime {
+					t.Errorf("Wrong timestamp type (kversion:%v): got LogAppendTime %v, want %v",
+						d.kversion, msg.LogAppendTime, d.logAppendTime)
+				}
 			case err := <-consumer.Errors():
 				t.Fatal(err)
 			}
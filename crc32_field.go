@@ -67,7 +67,7 @@ func (c *crc32Field) check(curOffset int, buf []byte) error {
 
 	expected := binary.BigEndian.Uint32(buf[c.startOffset:])
 	if crc != expected {
-		return PacketDecodingError{fmt.Sprintf("CRC didn't match expected %#x got %#x", expected, crc)}
+		return Wrap(ErrCRCMismatch, PacketDecodingError{fmt.Sprintf("CRC didn't match expected %#x got %#x", expected, crc)})
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package sarama
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/rcrowley/go-metrics"
 )
@@ -19,6 +20,16 @@ type encoderWithHeader interface {
 
 // Encode takes an Encoder and turns it into bytes while potentially recording metrics.
 func encode(e encoder, metricRegistry metrics.Registry) ([]byte, error) {
+	return encodeWith(e, metricRegistry, makeEncodeBuffer)
+}
+
+// encodePooled is like encode but takes its buffer from a pool. The caller
+// must pass the result to releaseEncodeBuffer once nothing references it.
+func encodePooled(e encoder, metricRegistry metrics.Registry) ([]byte, error) {
+	return encodeWith(e, metricRegistry, acquireEncodeBuffer)
+}
+
+func encodeWith(e encoder, metricRegistry metrics.Registry, alloc func(length int) []byte) ([]byte, error) {
 	if e == nil {
 		return nil, nil
 	}
@@ -35,7 +46,7 @@ func encode(e encoder, metricRegistry metrics.Registry) ([]byte, error) {
 		return nil, PacketEncodingError{fmt.Sprintf("invalid request size (%d)", prepEnc.length)}
 	}
 
-	realEnc.raw = make([]byte, prepEnc.length)
+	realEnc.raw = alloc(prepEnc.length)
 	realEnc.registry = metricRegistry
 	err = e.encode(&realEnc)
 	if err != nil {
@@ -45,6 +56,48 @@ func encode(e encoder, metricRegistry metrics.Registry) ([]byte, error) {
 	return realEnc.raw, nil
 }
 
+func makeEncodeBuffer(length int) []byte {
+	return make([]byte, length)
+}
+
+const (
+	minPooledBufferShift = 10 // 1KiB
+	maxPooledBufferShift = 20 // 1MiB
+)
+
+// encodeBufferPools holds one pool per power-of-two buffer capacity between
+// 1<<minPooledBufferShift and 1<<maxPooledBufferShift. Larger buffers are not
+// pooled.
+var encodeBufferPools [maxPooledBufferShift - minPooledBufferShift + 1]sync.Pool
+
+func encodeBufferClass(length int) int {
+	for class := range encodeBufferPools {
+		if length <= 1<<(class+minPooledBufferShift) {
+			return class
+		}
+	}
+	return -1
+}
+
+func acquireEncodeBuffer(length int) []byte {
+	class := encodeBufferClass(length)
+	if class < 0 {
+		return make([]byte, length)
+	}
+	if buf, ok := encodeBufferPools[class].Get().(*[]byte); ok {
+		return (*buf)[:length]
+	}
+	return make([]byte, length, 1<<(class+minPooledBufferShift))
+}
+
+func releaseEncodeBuffer(buf []byte) {
+	class := encodeBufferClass(cap(buf))
+	if class < 0 || cap(buf) != 1<<(class+minPooledBufferShift) {
+		return
+	}
+	encodeBufferPools[class].Put(&buf)
+}
+
 // decoder is the interface that wraps the basic Decode method.
 // Anything implementing Decoder can be extracted from bytes using Kafka's encoding rules.
 type decoder interface {
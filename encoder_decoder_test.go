@@ -0,0 +1,20 @@
+package sarama
+
+import "testing"
+
+func TestEncodeBufferPool(t *testing.T) {
+	for _, length := range []int{0, 100, 1 << 10, 1<<10 + 1, 1 << 20} {
+		buf := acquireEncodeBuffer(length)
+		if len(buf) != length {
+			t.Errorf("Expected a buffer of length %d, got %d", length, len(buf))
+		}
+		if c := cap(buf); c&(c-1) != 0 || c < length {
+			t.Errorf("Expected a power-of-two capacity of at least %d, got %d", length, c)
+		}
+		releaseEncodeBuffer(buf)
+	}
+
+	if buf := acquireEncodeBuffer(1<<20 + 1); cap(buf) != 1<<20+1 {
+		t.Errorf("Expected buffers above the largest size class not to be rounded up, got capacity %d", cap(buf))
+	}
+}
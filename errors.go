@@ -3,6 +3,7 @@ package sarama
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
@@ -47,6 +48,11 @@ var ErrMessageTooLarge = errors.New("kafka: message is larger than Consumer.Fetc
 // a RecordBatch.
 var ErrConsumerOffsetNotAdvanced = errors.New("kafka: consumer offset was not advanced after a RecordBatch")
 
+// ErrCRCMismatch is returned when the CRC of a decoded message or record batch
+// does not match its contents, meaning the data was corrupted. It wraps the
+// PacketDecodingError describing the mismatch.
+var ErrCRCMismatch = errors.New("kafka: CRC mismatch, the data is corrupt")
+
 // ErrControllerNotAvailable is returned when server didn't give correct controller id. May be kafka server's version
 // is lower than 0.10.0.0.
 var ErrControllerNotAvailable = errors.New("kafka: controller is not available")
@@ -118,6 +124,35 @@ func multiError(wrapped ...error) error {
 	return merr.ErrorOrNil()
 }
 
+// TopicMetadataError is returned by a metadata refresh in which more than one
+// topic came back with an error. It maps each failing topic to its error, and
+// matches any of those errors with errors.Is. A refresh in which only one
+// topic failed returns that topic's error directly.
+type TopicMetadataError map[string]KError
+
+func (err TopicMetadataError) Error() string {
+	topics := make([]string, 0, len(err))
+	for topic := range err {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	points := make([]string, len(topics))
+	for i, topic := range topics {
+		points[i] = fmt.Sprintf("%s: %s", topic, err[topic])
+	}
+	return fmt.Sprintf("kafka: metadata refresh failed for %d topics (%s)", len(err), strings.Join(points, "; "))
+}
+
+func (err TopicMetadataError) Is(target error) bool {
+	for _, kerr := range err {
+		if errors.Is(kerr, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // PacketEncodingError is returned from a failure while encoding a Kafka packet. This can happen, for example,
 // if you try to encode a string over 2^15 characters in length, since Kafka's encoding rules do not permit that.
 type PacketEncodingError struct {
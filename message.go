@@ -168,6 +168,12 @@ func (m *Message) decode(pd packetDecoder) (err error) {
 	// for future metrics about the compression ratio in fetch requests
 	m.compressedSize = len(m.Value)
 
+	// Verify the CRC of the (possibly compressed) message before touching
+	// the payload, so corrupt data is never handed to the decompressor.
+	if err := pd.pop(); err != nil {
+		return err
+	}
+
 	if m.Value != nil && m.Codec != CompressionNone {
 		m.Value, err = decompress(m.Codec, m.Value)
 		if err != nil {
@@ -179,7 +185,7 @@ func (m *Message) decode(pd packetDecoder) (err error) {
 		}
 	}
 
-	return pd.pop()
+	return nil
 }
 
 // decodes a message set from a previously encoded bulk-message
@@ -1,6 +1,8 @@
 package sarama
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 	"time"
 )
@@ -197,6 +199,82 @@ func TestMessageDecodingBulkGzip(t *testing.T) {
 	}
 }
 
+func TestMessageGzipRoundTrip(t *testing.T) {
+	inner := &MessageSet{}
+	inner.Messages = append(inner.Messages,
+		&MessageBlock{Offset: 10, Msg: &Message{Key: []byte("a"), Value: []byte("first")}},
+		&MessageBlock{Offset: 11, Msg: &Message{Value: []byte("second")}},
+	)
+	innerBytes, err := encode(inner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapper := &Message{Codec: CompressionGZIP, CompressionLevel: CompressionLevelDefault, Value: innerBytes}
+	buf, err := encode(wrapper, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := Message{}
+	if err := decode(buf, &decoded, nil); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Codec != CompressionGZIP {
+		t.Errorf("Decoding produced codec %d, but expected %d.", decoded.Codec, CompressionGZIP)
+	}
+	if decoded.Set == nil || len(decoded.Set.Messages) != 2 {
+		t.Fatal("Decoding did not expand the two inner messages")
+	}
+	for i, block := range decoded.Set.Messages {
+		want := inner.Messages[i]
+		if block.Offset != want.Offset {
+			t.Errorf("Message %d: expected offset %d, got %d", i, want.Offset, block.Offset)
+		}
+		if block.Msg.Codec != CompressionNone {
+			t.Errorf("Message %d: expected an uncompressed inner message", i)
+		}
+		if !bytes.Equal(block.Msg.Key, want.Msg.Key) || !bytes.Equal(block.Msg.Value, want.Msg.Value) {
+			t.Errorf("Message %d: expected %q/%q, got %q/%q", i, want.Msg.Key, want.Msg.Value, block.Msg.Key, block.Msg.Value)
+		}
+	}
+}
+
+func TestMessageNilAndEmptyKeyRoundTrip(t *testing.T) {
+	for _, key := range [][]byte{nil, {}} {
+		buf, err := encode(&Message{Key: key, Value: []byte("value")}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := Message{}
+		if err := decode(buf, &decoded, nil); err != nil {
+			t.Fatal(err)
+		}
+		if (key == nil) != (decoded.Key == nil) || len(decoded.Key) != 0 {
+			t.Errorf("Expected key %#v to survive a round trip, got %#v", key, decoded.Key)
+		}
+	}
+}
+
+func TestMessageCorruptCompressedPayload(t *testing.T) {
+	wrapper := &Message{Codec: CompressionGZIP, CompressionLevel: CompressionLevelDefault, Value: []byte("payload")}
+	buf, err := encode(wrapper, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[len(buf)-1] ^= 0xff
+
+	err = decode(buf, &Message{}, nil)
+	if !errors.Is(err, ErrCRCMismatch) {
+		t.Errorf("Expected the CRC mismatch to be reported before decompression, got %v", err)
+	}
+	var decodingErr PacketDecodingError
+	if !errors.As(err, &decodingErr) {
+		t.Errorf("Expected the CRC mismatch to still be a PacketDecodingError, got %T", err)
+	}
+}
+
 func TestMessageDecodingBulkLZ4(t *testing.T) {
 	message := Message{}
 	testDecodable(t, "bulk lz4", &message, emptyBulkLZ4Message)
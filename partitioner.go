@@ -1,9 +1,11 @@
 package sarama
 
 import (
+	"encoding/binary"
 	"hash"
 	"hash/fnv"
 	"math/rand"
+	"sync/atomic"
 	"time"
 )
 
@@ -101,21 +103,22 @@ func (p *randomPartitioner) RequiresConsistency() bool {
 }
 
 type roundRobinPartitioner struct {
-	partition int32
+	counter uint32
 }
 
 // NewRoundRobinPartitioner returns a Partitioner which walks through the available partitions one at a time.
+// It is safe for concurrent use, and wraps against the partition count given on each call, so a change in the
+// number of partitions never makes it return an out-of-range partition.
 func NewRoundRobinPartitioner(topic string) Partitioner {
 	return &roundRobinPartitioner{}
 }
 
 func (p *roundRobinPartitioner) Partition(message *ProducerMessage, numPartitions int32) (int32, error) {
-	if p.partition >= numPartitions {
-		p.partition = 0
+	if numPartitions <= 0 {
+		return -1, ErrInvalidPartition
 	}
-	ret := p.partition
-	p.partition++
-	return ret, nil
+	next := atomic.AddUint32(&p.counter, 1) - 1
+	return int32(next % uint32(numPartitions)), nil
 }
 
 func (p *roundRobinPartitioner) RequiresConsistency() bool {
@@ -158,7 +161,9 @@ func NewCustomPartitioner(options ...HashPartitionerOption) PartitionerConstruct
 // NewHashPartitioner returns a Partitioner which behaves as follows. If the message's key is nil then a
 // random partition is chosen. Otherwise the FNV-1a hash of the encoded bytes of the message key is used,
 // modulus the number of partitions. This ensures that messages with the same key always end up on the
-// same partition.
+// same partition. Note that the reference Java client hashes keys with murmur2, so a given key will
+// usually land on a different partition than with that client; use NewMurmur2Partitioner if both
+// clients produce to the same topic.
 func NewHashPartitioner(topic string) Partitioner {
 	p := new(hashPartitioner)
 	p.random = NewRandomPartitioner(topic)
@@ -179,6 +184,17 @@ func NewReferenceHashPartitioner(topic string) Partitioner {
 	return p
 }
 
+// NewMurmur2Partitioner returns a Partitioner which behaves like NewReferenceHashPartitioner but hashes
+// the encoded message key with murmur2, the hash used by the default partitioner of the reference
+// Java client. A given key therefore lands on the same partition as when produced by that client.
+func NewMurmur2Partitioner(topic string) Partitioner {
+	p := new(hashPartitioner)
+	p.random = NewRandomPartitioner(topic)
+	p.hasher = newMurmur2()
+	p.referenceAbs = true
+	return p
+}
+
 func (p *hashPartitioner) Partition(message *ProducerMessage, numPartitions int32) (int32, error) {
 	if message.Key == nil {
 		return p.random.Partition(message, numPartitions)
@@ -215,3 +231,74 @@ func (p *hashPartitioner) RequiresConsistency() bool {
 func (p *hashPartitioner) MessageRequiresConsistency(message *ProducerMessage) bool {
 	return message.Key != nil
 }
+
+// murmur2 implements hash.Hash32 with the murmur2 variant (and seed) used by
+// the reference Java client. The algorithm is not incremental, so written
+// bytes are buffered until Sum32 is called.
+type murmur2 struct {
+	data []byte
+}
+
+func newMurmur2() hash.Hash32 {
+	return new(murmur2)
+}
+
+func (m *murmur2) Write(p []byte) (int, error) {
+	m.data = append(m.data, p...)
+	return len(p), nil
+}
+
+func (m *murmur2) Sum(b []byte) []byte {
+	h := m.Sum32()
+	return append(b, byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
+
+func (m *murmur2) Reset() {
+	m.data = m.data[:0]
+}
+
+func (m *murmur2) Size() int {
+	return 4
+}
+
+func (m *murmur2) BlockSize() int {
+	return 4
+}
+
+func (m *murmur2) Sum32() uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		mul  uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(m.data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(m.data[i:])
+		k *= mul
+		k ^= k >> r
+		k *= mul
+		h *= mul
+		h ^= k
+	}
+
+	tail := m.data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= mul
+	}
+
+	h ^= h >> 13
+	h *= mul
+	h ^= h >> 15
+	return h
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"hash/fnv"
 	"log"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -71,6 +73,54 @@ func TestRoundRobinPartitioner(t *testing.T) {
 	}
 }
 
+func TestRoundRobinPartitionerConcurrent(t *testing.T) {
+	partitioner := NewRoundRobinPartitioner("mytopic")
+
+	const goroutines, perGoroutine, numPartitions = 8, 70, 7
+	counts := make([]int32, numPartitions)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				choice, err := partitioner.Partition(nil, numPartitions)
+				if err != nil {
+					t.Error(partitioner, err)
+					return
+				}
+				atomic.AddInt32(&counts[choice], 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for partition, count := range counts {
+		if count != goroutines*perGoroutine/numPartitions {
+			t.Errorf("Partition %d chosen %d times, expected an even spread", partition, count)
+		}
+	}
+}
+
+func TestRoundRobinPartitionerShrinkingPartitions(t *testing.T) {
+	partitioner := NewRoundRobinPartitioner("mytopic")
+
+	for i := 0; i < 5; i++ {
+		if _, err := partitioner.Partition(nil, 10); err != nil {
+			t.Error(partitioner, err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		choice, err := partitioner.Partition(nil, 3)
+		if err != nil {
+			t.Error(partitioner, err)
+		}
+		if choice < 0 || choice >= 3 {
+			t.Error("Returned out of range partition", choice)
+		}
+	}
+}
+
 func TestNewHashPartitionerWithHasher(t *testing.T) {
 	// use the current default hasher fnv.New32a()
 	partitioner := NewCustomHashPartitioner(fnv.New32a)("mytopic")
@@ -185,6 +235,42 @@ func TestHashPartitionerMinInt32(t *testing.T) {
 	}
 }
 
+func TestMurmur2MatchesReference(t *testing.T) {
+	// expected values as computed by the reference Java client
+	for key, expected := range map[string]int32{
+		"":                           275646681,
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		hasher := newMurmur2()
+		if _, err := hasher.Write([]byte(key)); err != nil {
+			t.Fatal(err)
+		}
+		if hash := int32(hasher.Sum32()); hash != expected {
+			t.Errorf("murmur2(%q) = %d, expected %d", key, hash, expected)
+		}
+	}
+}
+
+func TestMurmur2Partitioner(t *testing.T) {
+	partitioner := NewMurmur2Partitioner("mytopic")
+
+	choice, err := partitioner.Partition(&ProducerMessage{Key: StringEncoder("foobar")}, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (-790332482 & 0x7fffffff) % 11
+	if choice != 8 {
+		t.Error("Expected key foobar to be assigned to partition 8, got", choice)
+	}
+
+	assertPartitioningConsistent(t, partitioner, &ProducerMessage{Key: StringEncoder("foobar")}, 11)
+}
+
 func TestManualPartitioner(t *testing.T) {
 	partitioner := NewManualPartitioner("mytopic")
 
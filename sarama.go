@@ -35,6 +35,8 @@ Broker related metrics:
 	| request-size-for-broker-<broker-id>          | histogram  | Distribution of the request size in bytes for a given broker  |
 	| request-latency-in-ms                        | histogram  | Distribution of the request latency in ms for all brokers     |
 	| request-latency-in-ms-for-broker-<broker-id> | histogram  | Distribution of the request latency in ms for a given broker  |
+	| connect-latency-in-ms                        | histogram  | Distribution of the time in ms taken to connect to any broker |
+	|                                              |            | (TCP connect and TLS handshake)                               |
 	| response-rate                                | meter      | Responses/second received from all brokers                    |
 	| response-rate-for-broker-<broker-id>         | meter      | Responses/second received from a given broker                 |
 	| response-size                                | histogram  | Distribution of the response size in bytes for all brokers    |
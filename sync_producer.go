@@ -17,6 +17,8 @@ type SyncProducer interface {
 	// SendMessage produces a given message, and returns only when it either has
 	// succeeded or failed to produce. It will return the partition and the offset
 	// of the produced message, or an error if the message failed to produce.
+	// With Producer.RequiredAcks set to NoResponse the broker reports no
+	// offset, so only the partition is meaningful.
 	SendMessage(msg *ProducerMessage) (partition int32, offset int64, err error)
 
 	// SendMessages produces a given set of messages, and returns only when all
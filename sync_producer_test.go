@@ -68,6 +68,7 @@ func TestSyncProducerBatch(t *testing.T) {
 
 	prodSuccess := new(ProduceResponse)
 	prodSuccess.AddTopicPartition("my_topic", 0, ErrNoError)
+	prodSuccess.Blocks["my_topic"][0].Offset = 42
 	leader.Returns(prodSuccess)
 
 	config := NewTestConfig()
@@ -78,7 +79,7 @@ func TestSyncProducerBatch(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = producer.SendMessages([]*ProducerMessage{
+	msgs := []*ProducerMessage{
 		{
 			Topic:    "my_topic",
 			Value:    StringEncoder(TestMessage),
@@ -94,11 +95,17 @@ func TestSyncProducerBatch(t *testing.T) {
 			Value:    StringEncoder(TestMessage),
 			Metadata: "test",
 		},
-	})
+	}
+	err = producer.SendMessages(msgs)
 
 	if err != nil {
 		t.Error(err)
 	}
+	for i, msg := range msgs {
+		if msg.Offset != 42+int64(i) {
+			t.Errorf("Message %d: expected offset %d, got %d", i, 42+i, msg.Offset)
+		}
+	}
 
 	safeClose(t, producer)
 	leader.Close()
@@ -0,0 +1,191 @@
+package sarama
+
+import (
+	"sync"
+	"time"
+)
+
+// TopicConsumer consumes every partition of a single topic and multiplexes their messages onto one channel;
+// each ConsumerMessage carries the partition it was read from. It runs one PartitionConsumer per partition, so
+// leader changes are handled exactly as for a PartitionConsumer. Partitions added to the topic later are picked
+// up from the client's cached metadata every Metadata.RefreshFrequency and consumed from their oldest offset.
+type TopicConsumer interface {
+	// Messages returns the read channel for the messages of all the partitions
+	// of the topic.
+	Messages() <-chan *ConsumerMessage
+
+	// Errors returns a read channel of errors that occurred during consuming, if
+	// enabled. By default, errors are logged and not returned over this channel.
+	// If you want to implement any custom error handling, set your config's
+	// Consumer.Return.Errors setting to true, and read from this channel.
+	Errors() <-chan *ConsumerError
+
+	// Close stops consuming all the partitions of the topic and then closes the
+	// Messages and Errors channels. Messages that have not been read yet are
+	// discarded. It is required to call this function before a TopicConsumer
+	// passes out of scope, as it will otherwise leak memory. You must call this
+	// before calling Close on the underlying client.
+	Close() error
+}
+
+type topicConsumer struct {
+	conf     *Config
+	consumer Consumer
+	topic    string
+
+	children     map[int32]PartitionConsumer
+	childrenLock sync.Mutex
+	forwarders   sync.WaitGroup
+
+	messages chan *ConsumerMessage
+	errors   chan *ConsumerError
+
+	closeOnce sync.Once
+	dying     chan none
+	watcher   chan none
+}
+
+// NewTopicConsumerFromClient creates a TopicConsumer which consumes every partition of the given topic, starting
+// at offset, which must be OffsetNewest or OffsetOldest. It is still necessary to call Close() on the underlying
+// client when finished with the topic consumer.
+func NewTopicConsumerFromClient(client Client, topic string, offset int64) (TopicConsumer, error) {
+	if offset != OffsetNewest && offset != OffsetOldest {
+		return nil, ConfigurationError("A TopicConsumer must start at OffsetNewest or OffsetOldest")
+	}
+
+	consumer, err := NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &topicConsumer{
+		conf:     client.Config(),
+		consumer: consumer,
+		topic:    topic,
+		children: make(map[int32]PartitionConsumer),
+		messages: make(chan *ConsumerMessage, client.Config().ChannelBufferSize),
+		errors:   make(chan *ConsumerError, client.Config().ChannelBufferSize),
+		dying:    make(chan none),
+		watcher:  make(chan none),
+	}
+
+	if err := tc.consumeNewPartitions(offset); err != nil {
+		close(tc.watcher)
+		_ = tc.Close()
+		return nil, err
+	}
+
+	if tc.conf.Metadata.RefreshFrequency > 0 {
+		go withRecover(tc.watchPartitions)
+	} else {
+		close(tc.watcher)
+	}
+
+	return tc, nil
+}
+
+func (tc *topicConsumer) Messages() <-chan *ConsumerMessage {
+	return tc.messages
+}
+
+func (tc *topicConsumer) Errors() <-chan *ConsumerError {
+	return tc.errors
+}
+
+func (tc *topicConsumer) Close() (err error) {
+	tc.closeOnce.Do(func() {
+		close(tc.dying)
+		<-tc.watcher
+
+		tc.childrenLock.Lock()
+		for _, child := range tc.children {
+			child.AsyncClose()
+		}
+		tc.childrenLock.Unlock()
+
+		tc.forwarders.Wait()
+		close(tc.messages)
+		close(tc.errors)
+
+		err = tc.consumer.Close()
+	})
+	return
+}
+
+// consumeNewPartitions starts consuming, at offset, every partition of the
+// topic that is not consumed yet.
+func (tc *topicConsumer) consumeNewPartitions(offset int64) error {
+	partitions, err := tc.consumer.Partitions(tc.topic)
+	if err != nil {
+		return err
+	}
+
+	tc.childrenLock.Lock()
+	defer tc.childrenLock.Unlock()
+
+	for _, partition := range partitions {
+		if _, ok := tc.children[partition]; ok {
+			continue
+		}
+
+		child, err := tc.consumer.ConsumePartition(tc.topic, partition, offset)
+		if err != nil {
+			return err
+		}
+		tc.children[partition] = child
+
+		tc.forwarders.Add(1)
+		go withRecover(func() { tc.forward(child) })
+	}
+	return nil
+}
+
+// watchPartitions periodically checks the cached metadata for partitions
+// added to the topic.
+func (tc *topicConsumer) watchPartitions() {
+	defer close(tc.watcher)
+
+	ticker := time.NewTicker(tc.conf.Metadata.RefreshFrequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tc.dying:
+			return
+		case <-ticker.C:
+			if err := tc.consumeNewPartitions(OffsetOldest); err != nil {
+				Logger.Printf("consumer/%s failed to consume new partitions: %v\n", tc.topic, err)
+			}
+		}
+	}
+}
+
+// forward copies the messages and errors of child onto the shared channels
+// until child is closed. Once the TopicConsumer is dying they are dropped.
+func (tc *topicConsumer) forward(child PartitionConsumer) {
+	defer tc.forwarders.Done()
+
+	messages, errors := child.Messages(), child.Errors()
+	for messages != nil || errors != nil {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			select {
+			case tc.messages <- msg:
+			case <-tc.dying:
+			}
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			select {
+			case tc.errors <- err:
+			case <-tc.dying:
+			}
+		}
+	}
+}
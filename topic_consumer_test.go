@@ -0,0 +1,126 @@
+package sarama
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopicConsumerAllPartitions(t *testing.T) {
+	broker0 := NewMockBroker(t, 0)
+	defer broker0.Close()
+
+	fetchResponse := NewMockFetchResponse(t, 1).
+		SetMessage("my_topic", 0, 0, testMsg).
+		SetMessage("my_topic", 1, 0, testMsg)
+	broker0.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()).
+			SetLeader("my_topic", 1, broker0.BrokerID()),
+		"OffsetRequest": NewMockOffsetResponse(t).
+			SetOffset("my_topic", 0, OffsetOldest, 0).
+			SetOffset("my_topic", 0, OffsetNewest, 1).
+			SetOffset("my_topic", 1, OffsetOldest, 0).
+			SetOffset("my_topic", 1, OffsetNewest, 1),
+		"FetchRequest": fetchResponse,
+	})
+
+	client, err := NewClient([]string{broker0.Addr()}, NewTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	consumer, err := NewTopicConsumerFromClient(client, "my_topic", OffsetOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, consumer)
+
+	seen := make(map[int32]bool)
+	for len(seen) < 2 {
+		select {
+		case msg := <-consumer.Messages():
+			if msg.Topic != "my_topic" || msg.Offset != 0 {
+				t.Errorf("Unexpected message %s/%d at offset %d", msg.Topic, msg.Partition, msg.Offset)
+			}
+			seen[msg.Partition] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for messages, only got partitions %v", seen)
+		}
+	}
+}
+
+func TestTopicConsumerNewPartitions(t *testing.T) {
+	broker0 := NewMockBroker(t, 0)
+	defer broker0.Close()
+
+	fetchResponse := NewMockFetchResponse(t, 1).
+		SetMessage("my_topic", 1, 0, testMsg)
+	offsetResponse := NewMockOffsetResponse(t).
+		SetOffset("my_topic", 0, OffsetOldest, 0).
+		SetOffset("my_topic", 0, OffsetNewest, 0).
+		SetOffset("my_topic", 1, OffsetOldest, 0).
+		SetOffset("my_topic", 1, OffsetNewest, 1)
+	broker0.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()),
+		"OffsetRequest": offsetResponse,
+		"FetchRequest":  fetchResponse,
+	})
+
+	config := NewTestConfig()
+	config.Metadata.RefreshFrequency = 50 * time.Millisecond
+	client, err := NewClient([]string{broker0.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	consumer, err := NewTopicConsumerFromClient(client, "my_topic", OffsetNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, consumer)
+
+	// the topic grows a second partition
+	broker0.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()).
+			SetLeader("my_topic", 1, broker0.BrokerID()),
+		"OffsetRequest": offsetResponse,
+		"FetchRequest":  fetchResponse,
+	})
+
+	select {
+	case msg := <-consumer.Messages():
+		if msg.Partition != 1 || msg.Offset != 0 {
+			t.Errorf("Expected the message at offset 0 of partition 1, got %d/%d", msg.Partition, msg.Offset)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the new partition to be consumed")
+	}
+}
+
+func TestTopicConsumerRequiresRelativeOffset(t *testing.T) {
+	broker0 := NewMockBroker(t, 0)
+	defer broker0.Close()
+
+	broker0.SetHandlerByMap(map[string]MockResponse{
+		"MetadataRequest": NewMockMetadataResponse(t).
+			SetBroker(broker0.Addr(), broker0.BrokerID()).
+			SetLeader("my_topic", 0, broker0.BrokerID()),
+	})
+
+	client, err := NewClient([]string{broker0.Addr()}, NewTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer safeClose(t, client)
+
+	if _, err := NewTopicConsumerFromClient(client, "my_topic", 1234); err == nil {
+		t.Error("Expected an error for an absolute starting offset")
+	}
+}
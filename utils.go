@@ -3,8 +3,11 @@ package sarama
 import (
 	"bufio"
 	"fmt"
+	"math/rand"
 	"net"
 	"regexp"
+	"sync"
+	"time"
 )
 
 type none struct{}
@@ -54,6 +57,49 @@ func safeAsyncClose(b *Broker) {
 	})
 }
 
+// NewExponentialBackoff returns a function suitable for use as a
+// Metadata.Retry.BackoffFunc or Producer.Retry.BackoffFunc. The returned
+// function waits backoff when retries is 0 and doubles the wait for each
+// retry after that, never waiting longer than maxBackoff.
+//
+// Metadata.Retry counts retries from 0, so the first metadata retry waits
+// backoff. Producer.Retry counts them from 1, so the first producer retry
+// already waits twice backoff; pass half the wanted first wait when using it
+// there.
+func NewExponentialBackoff(backoff time.Duration, maxBackoff time.Duration) func(retries, maxRetries int) time.Duration {
+	return func(retries, maxRetries int) time.Duration {
+		if retries < 0 {
+			retries = 0
+		}
+		wait := backoff
+		for i := 0; i < retries && wait < maxBackoff; i++ {
+			wait *= 2
+		}
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+		return wait
+	}
+}
+
+// NewJitteredBackoff wraps a backoff function, such as one returned by
+// NewExponentialBackoff, so that each wait is randomly shortened to between
+// half and all of its value. Clients using it do not retry in lockstep after a
+// shared failure. Each call seeds its own random source.
+func NewJitteredBackoff(backoffFunc func(retries, maxRetries int) time.Duration) func(retries, maxRetries int) time.Duration {
+	var lock sync.Mutex
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	return func(retries, maxRetries int) time.Duration {
+		lock.Lock()
+		jitter := random.Float64()
+		lock.Unlock()
+
+		wait := backoffFunc(retries, maxRetries)
+		return wait/2 + time.Duration(float64(wait/2)*jitter)
+	}
+}
+
 // Encoder is a simple interface for any type that can be encoded as an array of bytes
 // in order to be sent as the key or value of a Kafka message. Length() is provided as an
 // optimization, and must return the same as len() on the result of Encode().
@@ -96,10 +142,10 @@ type bufConn struct {
 	buf *bufio.Reader
 }
 
-func newBufConn(conn net.Conn) *bufConn {
+func newBufConn(conn net.Conn, readBufferSize int) *bufConn {
 	return &bufConn{
 		Conn: conn,
-		buf:  bufio.NewReader(conn),
+		buf:  bufio.NewReaderSize(conn, readBufferSize),
 	}
 }
 
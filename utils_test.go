@@ -1,6 +1,9 @@
 package sarama
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestVersionCompare(t *testing.T) {
 	if V0_8_2_0.IsAtLeast(V0_8_2_1) {
@@ -93,3 +96,51 @@ func TestVersionParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := NewExponentialBackoff(250*time.Millisecond, 2*time.Second)
+
+	expected := []time.Duration{
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		1 * time.Second,
+		2 * time.Second,
+		2 * time.Second,
+	}
+	for retries, want := range expected {
+		if got := backoff(retries, len(expected)); got != want {
+			t.Errorf("retry %d: expected backoff %v, got %v", retries, want, got)
+		}
+	}
+}
+
+func TestExponentialBackoffProducerRetries(t *testing.T) {
+	// the producer numbers its first retry 1, so halving the initial backoff
+	// makes its first retry wait the wanted 250ms
+	backoff := NewExponentialBackoff(125*time.Millisecond, 2*time.Second)
+
+	expected := []time.Duration{
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		1 * time.Second,
+		2 * time.Second,
+	}
+	for i, want := range expected {
+		retries := i + 1
+		if got := backoff(retries, len(expected)); got != want {
+			t.Errorf("producer retry %d: expected backoff %v, got %v", retries, want, got)
+		}
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	backoff := NewJitteredBackoff(NewExponentialBackoff(250*time.Millisecond, 2*time.Second))
+
+	for retries, full := range []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if got := backoff(retries, 4); got < full/2 || got > full {
+				t.Fatalf("retry %d: expected backoff between %v and %v, got %v", retries, full/2, full, got)
+			}
+		}
+	}
+}